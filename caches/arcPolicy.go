@@ -0,0 +1,134 @@
+package caches
+
+import (
+	"github.com/jf-tech/go-corelib/maths"
+)
+
+// ghostList is a LRU ordered list of keys of recently evicted entries, used by the policies that
+// adapt to the workload based on the history beyond the resident entries. Not thread-safe.
+type ghostList[K comparable] struct {
+	keys map[K]*entry[K, struct{}]
+	l    *entryList[K, struct{}]
+}
+
+func newGhostList[K comparable]() *ghostList[K] {
+	return &ghostList[K]{keys: make(map[K]*entry[K, struct{}]), l: newEntryList[K, struct{}]()}
+}
+
+func (g *ghostList[K]) len() int {
+	return g.l.len()
+}
+
+func (g *ghostList[K]) pushFront(key K) {
+	e := &entry[K, struct{}]{key: key}
+	g.keys[key] = e
+	g.l.pushFront(e)
+}
+
+// remove removes the key from the list and returns whether it was in the list.
+func (g *ghostList[K]) remove(key K) bool {
+	e, found := g.keys[key]
+	if !found {
+		return false
+	}
+	g.l.remove(e)
+	delete(g.keys, key)
+	return true
+}
+
+func (g *ghostList[K]) removeBack() {
+	if e := g.l.back(); e != nil {
+		g.l.remove(e)
+		delete(g.keys, e.key)
+	}
+}
+
+const (
+	arcT1 uint8 = iota // resident entries seen once recently.
+	arcT2              // resident entries seen at least twice recently.
+)
+
+// arcPolicy implements the Adaptive Replacement Cache policy as described in "ARC: A Self-Tuning, Low
+// Overhead Replacement Cache" by N. Megiddo and D. Modha.
+type arcPolicy[K comparable, V any] struct {
+	capacity int
+	p        int // target size of t1.
+	t1, t2   *entryList[K, V]
+	b1, b2   *ghostList[K] // ghosts of the entries evicted from t1 and t2, respectively.
+	newest   *entry[K, V]  // the most recently added entry.
+}
+
+func newARCPolicy[K comparable, V any](capacity int) *arcPolicy[K, V] {
+	return &arcPolicy[K, V]{
+		capacity: capacity,
+		t1:       newEntryList[K, V](),
+		t2:       newEntryList[K, V](),
+		b1:       newGhostList[K](),
+		b2:       newGhostList[K](),
+	}
+}
+
+func (p *arcPolicy[K, V]) add(e *entry[K, V]) {
+	p.newest = e
+	switch {
+	case p.b1.remove(e.key):
+		// recently evicted from t1: t1 should have been bigger.
+		p.p = maths.MinInt(p.capacity, p.p+maths.MaxInt(p.b2.len()/maths.MaxInt(p.b1.len(), 1), 1))
+		e.queue = arcT2
+		p.t2.pushFront(e)
+	case p.b2.remove(e.key):
+		// recently evicted from t2: t2 should have been bigger.
+		p.p = maths.MaxInt(0, p.p-maths.MaxInt(p.b1.len()/maths.MaxInt(p.b2.len(), 1), 1))
+		e.queue = arcT2
+		p.t2.pushFront(e)
+	default:
+		e.queue = arcT1
+		p.t1.pushFront(e)
+	}
+	// keep the history bounded: |t1|+|b1| <= c and |t1|+|t2|+|b1|+|b2| <= 2c.
+	for p.b1.len() > 0 && p.t1.len()+p.b1.len() > p.capacity {
+		p.b1.removeBack()
+	}
+	// (written as "... - c > c" to avoid overflowing when there is no capacity limit.)
+	for p.b2.len() > 0 && p.t1.len()+p.t2.len()+p.b1.len()+p.b2.len()-p.capacity > p.capacity {
+		p.b2.removeBack()
+	}
+}
+
+func (p *arcPolicy[K, V]) access(e *entry[K, V]) {
+	if e.queue == arcT1 {
+		p.t1.remove(e)
+		e.queue = arcT2
+		p.t2.pushFront(e)
+		return
+	}
+	p.t2.moveToFront(e)
+}
+
+func (p *arcPolicy[K, V]) remove(e *entry[K, V]) {
+	if e.queue == arcT1 {
+		p.t1.remove(e)
+	} else {
+		p.t2.remove(e)
+	}
+}
+
+func (p *arcPolicy[K, V]) victim() *entry[K, V] {
+	// ARC makes room (the "REPLACE" routine) before a new entry goes into t1, while a store adds an
+	// entry first and then asks for a victim. So the newest entry, if still at the front of t1,
+	// isn't counted, and is only evicted if it's the last entry standing.
+	t1Len := p.t1.len()
+	if p.newest != nil && p.t1.front() == p.newest {
+		t1Len--
+	}
+	if t1Len > 0 && (t1Len > p.p || p.t2.len() == 0) || p.t2.len() == 0 {
+		e := p.t1.back()
+		p.t1.remove(e)
+		p.b1.pushFront(e.key)
+		return e
+	}
+	e := p.t2.back()
+	p.t2.remove(e)
+	p.b2.pushFront(e.key)
+	return e
+}
@@ -0,0 +1,77 @@
+package caches
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGhostList(t *testing.T) {
+	g := newGhostList[string]()
+	g.removeBack()
+	assert.Equal(t, 0, g.len())
+	g.pushFront("a")
+	g.pushFront("b")
+	g.pushFront("c")
+	assert.Equal(t, 3, g.len())
+	assert.True(t, g.remove("b"))
+	assert.False(t, g.remove("b"))
+	g.removeBack()
+	assert.Equal(t, 1, g.len())
+	assert.False(t, g.remove("a"))
+	assert.True(t, g.remove("c"))
+	assert.Equal(t, 0, g.len())
+}
+
+func TestARCPolicy(t *testing.T) {
+	s := newPolicyStoreForTest(EvictionPolicyARC, 4)
+	p := s.policy.(*arcPolicy[string, int])
+
+	// a and b are accessed twice, so they're in t2 and survive a scan of one-off keys.
+	s.access("a", "b", "a", "b")
+	assert.Equal(t, 0, p.t1.len())
+	assert.Equal(t, 2, p.t2.len())
+	s.access(scanKeys("x", 10)...)
+	assert.True(t, s.has("a", "b"))
+	assert.Equal(t, 8, len(s.evicted))
+	// history is bounded: |t1| + |b1| <= c.
+	assert.Equal(t, 2, p.t1.len())
+	assert.Equal(t, 2, p.b1.len())
+
+	s.access("x9", "x8") // still resident in t1, promoted to t2.
+	assert.Equal(t, 4, p.t2.len())
+	// a new key goes into t1, making room by evicting t2's lru entry a into b2.
+	s.access("y")
+	assert.Equal(t, arcT1, s.entries["y"].queue)
+	assert.False(t, s.has("a"))
+	assert.Equal(t, 1, p.b2.len())
+
+	// a hit in b1 means t1 should have been bigger: p grows and the key goes to t2.
+	s.access("x7")
+	assert.Equal(t, 1, p.p)
+	assert.Equal(t, arcT2, s.entries["x7"].queue)
+	assert.True(t, s.has("y"))
+	assert.Equal(t, 2, p.b2.len())
+
+	// a hit in b2 means t2 should have been bigger: p shrinks, and t1 gives up y.
+	s.access("b")
+	assert.Equal(t, 0, p.p)
+	assert.Equal(t, arcT2, s.entries["b"].queue)
+	assert.False(t, s.has("y"))
+
+	s.remove(s.entries["b"])
+	s.remove(s.entries["x7"])
+	assert.Equal(t, 2, s.len())
+	assert.Equal(t, []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "a", "b", "y"}, s.evicted)
+}
+
+func TestARCPolicy_NoCapacityLimit(t *testing.T) {
+	// make sure the history bound computation doesn't overflow without a capacity limit.
+	s := newPolicyStoreForTest(EvictionPolicyARC, resolveCapacity(0))
+	p := s.policy.(*arcPolicy[string, int])
+	p.b1.pushFront("ghost1")
+	p.b2.pushFront("ghost2")
+	s.access("a", "b", "c")
+	assert.Equal(t, 1, p.b1.len())
+	assert.Equal(t, 1, p.b2.len())
+}
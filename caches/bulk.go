@@ -0,0 +1,153 @@
+package caches
+
+import (
+	"fmt"
+)
+
+// TypedBulkLoadFunc is the type of the bulk loading function for TypedLoadingCache.GetAll. It's called
+// with a batch of distinct keys and returns the values of them, keyed by the keys. Values returned for
+// keys not in the batch are ignored.
+type TypedBulkLoadFunc[K comparable, V any] func(keys []K) (map[K]V, error)
+
+// BulkLoadFunc is the type of the bulk loading function for LoadingCache.GetAll.
+type BulkLoadFunc = TypedBulkLoadFunc[interface{}, interface{}]
+
+// ownedCall is a call created by GetAll, which GetAll must complete.
+type ownedCall[K comparable, V any] struct {
+	key K
+	cl  *call[V]
+	s   *segment[K, V]
+}
+
+// GetAll returns the values of all the keys. The keys found in the cache (including its on-disk second
+// level, if any) are served from the cache, and all the missing ones are loaded by a single call to
+// bulkLoad, and stored into the cache. If there are already loads in flight for some of the keys, GetAll
+// waits for them instead of loading those keys again. Conversely, concurrent Get callers of the keys
+// being loaded by bulkLoad wait for it. If bulkLoad returns an error, or doesn't return a value for some
+// of the keys, or a key has a negatively cached load error, GetAll returns the error (the first one in
+// the order of keys) and a nil map. If bulkLoad panics, the panic is re-raised in GetAll as well as in
+// all the waiters.
+//
+// Statistics wise, each key counts as a hit or a miss, and each key loaded by bulkLoad counts as a load
+// success or failure.
+func (c *TypedLoadingCache[K, V]) GetAll(keys []K, bulkLoad TypedBulkLoadFunc[K, V]) (map[K]V, error) {
+	vals := make(map[K]V, len(keys))
+	errs := make(map[K]error)
+	waits := make(map[K]*call[V])
+	var owned []ownedCall[K, V]
+	refreshLoad := loader[K, V]{load: singleLoad(bulkLoad)}
+	for _, key := range keys {
+		if _, found := vals[key]; found {
+			continue
+		}
+		if _, found := errs[key]; found {
+			continue
+		}
+		if _, found := waits[key]; found {
+			continue
+		}
+		s := c.segmentOf(key)
+		v, err, cl, owner := s.lookup(key, refreshLoad)
+		switch {
+		case cl == nil && err == nil:
+			vals[key] = v
+		case cl == nil:
+			errs[key] = err
+		default:
+			waits[key] = cl
+			if owner {
+				owned = append(owned, ownedCall[K, V]{key: key, cl: cl, s: s})
+			}
+		}
+	}
+	// The calls owned are completed before waiting for any other call, so two GetAll callers can never
+	// wait for each other.
+	if len(owned) > 0 {
+		c.bulkLoad(owned, bulkLoad)
+	}
+	for _, key := range keys {
+		if err, found := errs[key]; found {
+			return nil, err
+		}
+		cl, found := waits[key]
+		if !found {
+			continue
+		}
+		<-cl.done
+		v, err := cl.result()
+		if err != nil {
+			return nil, err
+		}
+		vals[key] = v
+	}
+	return vals, nil
+}
+
+// bulkLoad loads the keys of all the owned calls, from the on-disk second level if possible, or else
+// with a single bulkLoad call, and completes the calls.
+func (c *TypedLoadingCache[K, V]) bulkLoad(owned []ownedCall[K, V], bulkLoad TypedBulkLoadFunc[K, V]) {
+	normalReturn := false
+	start := c.clock.Now()
+	defer func() {
+		var r interface{}
+		if !normalReturn {
+			r = recover()
+		}
+		loadTime := c.clock.Now().Sub(start)
+		for _, o := range owned {
+			if !normalReturn {
+				recordAbnormalReturn(o.cl, r)
+			}
+			o.s.complete(o.key, o.cl, normalReturn, loadTime)
+			if !o.cl.fromDisk {
+				// the time of the single bulk load is only accounted once.
+				loadTime = 0
+			}
+		}
+		// The panic, if any, is re-raised by cl.result() in GetAll.
+	}()
+	keys := make([]K, 0, len(owned))
+	for _, o := range owned {
+		if !o.s.takeFromDisk(o.key, o.cl) {
+			keys = append(keys, o.key)
+		}
+	}
+	if len(keys) > 0 {
+		vals, err := bulkLoad(keys)
+		for _, o := range owned {
+			if o.cl.fromDisk {
+				continue
+			}
+			switch v, found := vals[o.key]; {
+			case err != nil:
+				o.cl.err = err
+			case !found:
+				o.cl.err = errNoBulkLoadValue(o.key)
+			default:
+				o.cl.val = v
+			}
+		}
+	}
+	normalReturn = true
+}
+
+// singleLoad adapts a bulk loading function into a loading function of a single key, for the
+// background refreshes kicked off by GetAll.
+func singleLoad[K comparable, V any](bulkLoad TypedBulkLoadFunc[K, V]) TypedLoadFunc[K, V] {
+	return func(key K) (V, error) {
+		vals, err := bulkLoad([]K{key})
+		if err != nil {
+			var zero V
+			return zero, err
+		}
+		v, found := vals[key]
+		if !found {
+			return v, errNoBulkLoadValue(key)
+		}
+		return v, nil
+	}
+}
+
+func errNoBulkLoadValue(key interface{}) error {
+	return fmt.Errorf("bulk load function returned no value for key: %v", key)
+}
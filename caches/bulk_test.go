@@ -0,0 +1,217 @@
+package caches
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedLoadingCache_GetAll(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		keys          []int
+		bulkLoad      TypedBulkLoadFunc[int, string]
+		expectedBatch []int
+		expected      map[int]string
+		expectedErr   string
+		expectedLen   int
+	}{
+		{
+			name: "cached keys served from cache, missing keys loaded in a single batch",
+			keys: []int{1, 5, 2, 6, 5, 7},
+			bulkLoad: func(keys []int) (map[int]string, error) {
+				vals := make(map[int]string)
+				for _, k := range keys {
+					vals[k] = strconv.Itoa(k)
+				}
+				// values of keys not asked for are ignored.
+				vals[100] = "100"
+				return vals, nil
+			},
+			expectedBatch: []int{5, 6, 7},
+			expected:      map[int]string{1: "one", 2: "two", 5: "5", 6: "6", 7: "7"},
+			expectedLen:   6,
+		},
+		{
+			name:        "all keys cached",
+			keys:        []int{3, 2, 1},
+			bulkLoad:    nil,
+			expected:    map[int]string{1: "one", 2: "two", 3: "three"},
+			expectedLen: 3,
+		},
+		{
+			name:          "no keys",
+			keys:          nil,
+			bulkLoad:      nil,
+			expectedBatch: nil,
+			expected:      map[int]string{},
+			expectedLen:   3,
+		},
+		{
+			name: "bulk load failure",
+			keys: []int{1, 5, 6},
+			bulkLoad: func(keys []int) (map[int]string, error) {
+				return nil, errors.New("test error")
+			},
+			expectedBatch: []int{5, 6},
+			expectedErr:   "test error",
+			expectedLen:   3,
+		},
+		{
+			name: "bulk load missing a key",
+			keys: []int{5, 6},
+			bulkLoad: func(keys []int) (map[int]string, error) {
+				return map[int]string{5: "5"}, nil
+			},
+			expectedBatch: []int{5, 6},
+			expectedErr:   "bulk load function returned no value for key: 6",
+			expectedLen:   4,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewTypedLoadingCache[int, string]()
+			c.Put(1, "one")
+			c.Put(2, "two")
+			c.Put(3, "three")
+			var batch []int
+			bulkLoad := test.bulkLoad
+			if bulkLoad != nil {
+				bulkLoad = func(keys []int) (map[int]string, error) {
+					assert.Nil(t, batch, "bulk load must only be called once")
+					batch = keys
+					return test.bulkLoad(keys)
+				}
+			}
+			vals, err := c.GetAll(test.keys, bulkLoad)
+			assert.Equal(t, test.expectedBatch, batch)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Nil(t, vals)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, vals)
+			}
+			assert.Equal(t, test.expectedLen, c.Len())
+		})
+	}
+}
+
+func TestTypedLoadingCache_GetAll_NegativeCachingAndStats(t *testing.T) {
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{ErrorMaxHits: 10, Shards: 4})
+	_, err := c.Get("bad", func(string) (int, error) { return 0, errors.New("bad key") })
+	assert.EqualError(t, err, "bad key")
+	c.Put("1", 1)
+	calls := 0
+	bulkLoad := func(keys []string) (map[string]int, error) {
+		calls++
+		vals := make(map[string]int)
+		for _, k := range keys {
+			vals[k], _ = strconv.Atoi(k)
+		}
+		return vals, nil
+	}
+	vals, err := c.GetAll([]string{"1", "2", "bad", "3"}, bulkLoad)
+	assert.EqualError(t, err, "bad key")
+	assert.Nil(t, vals)
+	// the other missing keys are still loaded and cached.
+	assert.Equal(t, 1, calls)
+	vals, err = c.GetAll([]string{"1", "2", "3"}, bulkLoad)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"1": 1, "2": 2, "3": 3}, vals)
+	assert.Equal(t, 1, calls)
+
+	st := c.Stats()
+	assert.Equal(t, int64(4), st.Hits)
+	assert.Equal(t, int64(1), st.ErrorHits)
+	assert.Equal(t, int64(3), st.Misses)
+	assert.Equal(t, int64(2), st.LoadSuccesses)
+	assert.Equal(t, int64(1), st.LoadFailures)
+}
+
+func TestTypedLoadingCache_GetAll_Panic(t *testing.T) {
+	c := NewTypedLoadingCache[string, int]()
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = c.GetAll([]string{"a", "b"}, func([]string) (map[string]int, error) { panic("boom") })
+	})
+	assert.Equal(t, 0, len(c.segments[0].calls))
+	assert.Equal(t, int64(2), c.Stats().LoadFailures)
+	// the cache must remain usable after a panicking bulk load.
+	vals, err := c.GetAll([]string{"a"}, func([]string) (map[string]int, error) {
+		return map[string]int{"a": 1}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, vals)
+}
+
+func TestTypedLoadingCache_GetAll_SharesLoadsWithGet(t *testing.T) {
+	c := NewTypedLoadingCache[string, int]()
+	getLoading := make(chan struct{})
+	releaseGet := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// an in-flight Get of "a", which GetAll must wait for instead of loading "a" again.
+		v, err := c.Get("a", func(string) (int, error) {
+			close(getLoading)
+			<-releaseGet
+			return 1, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v)
+	}()
+	<-getLoading
+
+	bulkLoading := make(chan struct{})
+	releaseBulk := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		vals, err := c.GetAll([]string{"a", "b"}, func(keys []string) (map[string]int, error) {
+			assert.Equal(t, []string{"b"}, keys)
+			close(bulkLoading)
+			<-releaseBulk
+			return map[string]int{"b": 2}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"a": 1, "b": 2}, vals)
+	}()
+	<-bulkLoading
+
+	// a Get of "b" waits for the bulk load instead of loading "b" again.
+	misses := c.Stats().Misses
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		v, err := c.Get("b", func(string) (int, error) { panic("must not be called") })
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+	}()
+	waitForMisses(c, misses+1)
+	close(releaseBulk)
+	close(releaseGet)
+	wg.Wait()
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, c.DumpForTest())
+}
+
+func TestSingleLoad(t *testing.T) {
+	load := singleLoad(func(keys []string) (map[string]int, error) {
+		switch keys[0] {
+		case "err":
+			return nil, errors.New("test error")
+		case "missing":
+			return map[string]int{}, nil
+		}
+		return map[string]int{keys[0]: len(keys[0])}, nil
+	})
+	v, err := load("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v)
+	_, err = load("err")
+	assert.EqualError(t, err, "test error")
+	_, err = load("missing")
+	assert.EqualError(t, err, "bulk load function returned no value for key: missing")
+}
@@ -0,0 +1,133 @@
+package caches
+
+import (
+	"context"
+	"sync"
+)
+
+// Names of the caches used by the Get* methods of CacheRegistry.
+const (
+	RegexCacheName          = "regex"
+	TimeLocationCacheName   = "timeLocation"
+	XPathExprCacheName      = "xpathExpr"
+	TemplateCacheName       = "template"
+	JSONPathCacheName       = "jsonPath"
+	StrftimeLayoutCacheName = "strftimeLayout"
+)
+
+// globalCaches maps the names of the well-known caches to their package-level vars.
+var globalCaches = map[string]**LoadingCache{
+	RegexCacheName:          &RegexCache,
+	TimeLocationCacheName:   &TimeLocationCache,
+	XPathExprCacheName:      &XPathExprCache,
+	TemplateCacheName:       &TemplateCache,
+	JSONPathCacheName:       &JSONPathCache,
+	StrftimeLayoutCacheName: &StrftimeLayoutCache,
+}
+
+// CacheRegistry owns a set of named caches, such as the ones backing GetRegex, GetTimeLocation and
+// GetTemplate. Unlike the package-level caches, which are shared by every package in the process, a
+// CacheRegistry can be scoped as needed, e.g. one per test or per tenant, and passed around explicitly
+// or attached to a context (see WithCacheRegistry). A CacheRegistry is thread-safe.
+type CacheRegistry struct {
+	mu       sync.RWMutex
+	caches   map[string]*LoadingCache
+	newCache func(name string) *LoadingCache
+	// global tells this is the default registry, whose well-known caches are the package-level vars
+	// (e.g. RegexCache), for backward compatibility.
+	global bool
+}
+
+// CacheRegistryOptions customizes a CacheRegistry created by NewCacheRegistryEx.
+type CacheRegistryOptions struct {
+	// NewCache creates the cache of the given name upon its first use. nil means all the caches are
+	// created by NewLoadingCache with the default capacity.
+	NewCache func(name string) *LoadingCache
+}
+
+// NewCacheRegistry creates a new CacheRegistry whose caches are all created with the default capacity.
+func NewCacheRegistry() *CacheRegistry {
+	return NewCacheRegistryEx(CacheRegistryOptions{})
+}
+
+// NewCacheRegistryEx creates a new CacheRegistry with the given options.
+func NewCacheRegistryEx(opts CacheRegistryOptions) *CacheRegistry {
+	r := &CacheRegistry{caches: make(map[string]*LoadingCache), newCache: opts.NewCache}
+	if r.newCache == nil {
+		r.newCache = func(string) *LoadingCache { return NewLoadingCache() }
+	}
+	return r
+}
+
+var defaultCacheRegistry = func() *CacheRegistry {
+	r := NewCacheRegistry()
+	r.global = true
+	return r
+}()
+
+// DefaultCacheRegistry returns the process-wide CacheRegistry the package-level functions (e.g. GetRegex)
+// delegate to. Its well-known caches are the package-level vars, e.g. its RegexCacheName cache is
+// RegexCache and its TemplateCacheName cache is TemplateCache.
+func DefaultCacheRegistry() *CacheRegistry {
+	return defaultCacheRegistry
+}
+
+// Cache returns the cache of the given name, creating it upon the first call for the name.
+func (r *CacheRegistry) Cache(name string) *LoadingCache {
+	r.mu.RLock()
+	c, found := r.lookup(name)
+	r.mu.RUnlock()
+	if found {
+		return c
+	}
+	// the cache is created outside of the lock, so that NewCache can use the registry. If another
+	// caller creates the cache meanwhile, the first one stored wins.
+	c = r.newCache(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, found := r.lookup(name); found {
+		return existing
+	}
+	r.caches[name] = c
+	return c
+}
+
+// lookup returns the cache of the given name, if any. Must be called with r.mu held.
+func (r *CacheRegistry) lookup(name string) (*LoadingCache, bool) {
+	if v, found := globalCaches[name]; found && r.global {
+		return *v, true
+	}
+	c, found := r.caches[name]
+	return c, found
+}
+
+// Register sets the cache of the given name, replacing the existing one, if any. Usually called right
+// after the registry is created, to customize some of its caches. For the default registry, registering
+// a well-known cache (e.g. RegexCacheName) replaces the corresponding package-level var (e.g. RegexCache);
+// Register is safe to call concurrently with the package-level functions (e.g. GetRegex), whereas
+// assigning the package-level var directly isn't.
+func (r *CacheRegistry) Register(name string, c *LoadingCache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, found := globalCaches[name]; found && r.global {
+		*v = c
+		return
+	}
+	r.caches[name] = c
+}
+
+type cacheRegistryCtxKey struct{}
+
+// WithCacheRegistry returns a copy of ctx carrying the given CacheRegistry.
+func WithCacheRegistry(ctx context.Context, r *CacheRegistry) context.Context {
+	return context.WithValue(ctx, cacheRegistryCtxKey{}, r)
+}
+
+// CacheRegistryFromContext returns the CacheRegistry carried by ctx, or the default registry if there
+// isn't one.
+func CacheRegistryFromContext(ctx context.Context) *CacheRegistry {
+	if r, ok := ctx.Value(cacheRegistryCtxKey{}).(*CacheRegistry); ok && r != nil {
+		return r
+	}
+	return defaultCacheRegistry
+}
@@ -0,0 +1,102 @@
+package caches
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheRegistry_Cache(t *testing.T) {
+	var created []string
+	r := NewCacheRegistryEx(CacheRegistryOptions{
+		NewCache: func(name string) *LoadingCache {
+			created = append(created, name)
+			return NewLoadingCache(10)
+		},
+	})
+	c := r.Cache("a")
+	assert.Equal(t, 10, c.capacity)
+	// the same cache is returned for the same name.
+	assert.True(t, c == r.Cache("a"))
+	assert.False(t, c == r.Cache("b"))
+	assert.Equal(t, []string{"a", "b"}, created)
+
+	custom := NewLoadingCache(5)
+	r.Register("a", custom)
+	assert.True(t, custom == r.Cache("a"))
+	assert.Equal(t, []string{"a", "b"}, created)
+
+	assert.Equal(t, defaultCapacity, NewCacheRegistry().Cache("a").capacity)
+
+	// NewCache can use the registry.
+	var r2 *CacheRegistry
+	r2 = NewCacheRegistryEx(CacheRegistryOptions{
+		NewCache: func(name string) *LoadingCache {
+			if name == "derived" {
+				return NewLoadingCache(r2.Cache("base").capacity + 1)
+			}
+			return NewLoadingCache(7)
+		},
+	})
+	assert.Equal(t, 8, r2.Cache("derived").capacity)
+	assert.Equal(t, 7, r2.Cache("base").capacity)
+}
+
+func TestCacheRegistry_ConcurrentRegister(t *testing.T) {
+	saved := RegexCache
+	defer func() { DefaultCacheRegistry().Register(RegexCacheName, saved) }()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			DefaultCacheRegistry().Register(RegexCacheName, NewLoadingCache())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, err := GetRegex("a+b")
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestDefaultCacheRegistry(t *testing.T) {
+	r := DefaultCacheRegistry()
+	for _, test := range []struct {
+		name string
+		v    **LoadingCache
+	}{
+		{name: RegexCacheName, v: &RegexCache},
+		{name: TimeLocationCacheName, v: &TimeLocationCache},
+		{name: XPathExprCacheName, v: &XPathExprCache},
+		{name: TemplateCacheName, v: &TemplateCache},
+		{name: JSONPathCacheName, v: &JSONPathCache},
+		{name: StrftimeLayoutCacheName, v: &StrftimeLayoutCache},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// replacing the package-level var replaces the cache of the default registry, and vice versa.
+			*test.v = NewLoadingCache()
+			assert.True(t, *test.v == r.Cache(test.name))
+			c := NewLoadingCache()
+			r.Register(test.name, c)
+			assert.True(t, c == *test.v)
+			assert.True(t, c == r.Cache(test.name))
+		})
+	}
+	c := NewLoadingCache()
+	r.Register("other", c)
+	assert.True(t, c == r.Cache("other"))
+}
+
+func TestCacheRegistryFromContext(t *testing.T) {
+	assert.True(t, DefaultCacheRegistry() == CacheRegistryFromContext(context.Background()))
+	r := NewCacheRegistry()
+	ctx := WithCacheRegistry(context.Background(), r)
+	assert.True(t, r == CacheRegistryFromContext(ctx))
+	assert.True(t, DefaultCacheRegistry() == CacheRegistryFromContext(WithCacheRegistry(ctx, nil)))
+}
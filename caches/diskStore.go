@@ -0,0 +1,359 @@
+package caches
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jf-tech/go-corelib/maths"
+)
+
+// DiskCodec converts keys and values of a TypedLoadingCache to and from bytes for its on-disk second
+// level. EncodeKey must be deterministic: equal keys must always be encoded into identical bytes, even
+// across processes, as the encoded key identifies the file an entry is stored in.
+type DiskCodec[K comparable, V any] interface {
+	EncodeKey(key K) ([]byte, error)
+	DecodeKey(data []byte) (K, error)
+	EncodeValue(val V) ([]byte, error)
+	DecodeValue(data []byte) (V, error)
+}
+
+// GobDiskCodec is a DiskCodec using encoding/gob. Note concrete types stored in interface{} keys or
+// values must be registered with gob.Register.
+type GobDiskCodec[K comparable, V any] struct{}
+
+func gobEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gobDecode[T any](data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// EncodeKey implements DiskCodec.
+func (GobDiskCodec[K, V]) EncodeKey(key K) ([]byte, error) {
+	return gobEncode(&key)
+}
+
+// DecodeKey implements DiskCodec.
+func (GobDiskCodec[K, V]) DecodeKey(data []byte) (K, error) {
+	return gobDecode[K](data)
+}
+
+// EncodeValue implements DiskCodec.
+func (GobDiskCodec[K, V]) EncodeValue(val V) ([]byte, error) {
+	return gobEncode(&val)
+}
+
+// DecodeValue implements DiskCodec.
+func (GobDiskCodec[K, V]) DecodeValue(data []byte) (V, error) {
+	return gobDecode[V](data)
+}
+
+// DiskStoreOptions configures the on-disk second level of a TypedLoadingCache.
+type DiskStoreOptions[K comparable, V any] struct {
+	// Dir is the directory the entries are stored in, one file per entry. It's created if not
+	// existing. The entries already in it (e.g. stored by a previous process) are picked up. Dir
+	// must not be shared by multiple caches at the same time.
+	Dir string
+	// Codec converts the keys and values to and from bytes. nil means GobDiskCodec is used.
+	Codec DiskCodec[K, V]
+	// MaxBytes is the max total size of the entry files in Dir. Once exceeded, the least recently
+	// stored entries are deleted. 0 means a reasonable default size limit is used.
+	MaxBytes int64
+}
+
+const (
+	defaultDiskMaxBytes = 64 << 20
+	diskEntryExt        = ".entry"
+	diskTempExt         = ".tmp"
+)
+
+var (
+	diskEntryMagic = [4]byte{'L', 'C', 'E', '1'}
+	crc32Table     = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// An entry file consists of a header followed by the encoded key and value:
+//
+//	magic      [4]byte
+//	crc        uint32  // crc32 (Castagnoli) of everything after this field.
+//	writeTime  int64   // unix nanoseconds.
+//	keyLen     uint32
+//	key        [keyLen]byte
+//	value      [...]byte
+const diskEntryHeaderLen = 4 + 4 + 8 + 4
+
+var errDiskEntryCorrupted = errors.New("disk entry corrupted")
+
+// diskStore is the on-disk second level of a TypedLoadingCache. Thread-safe.
+type diskStore[K comparable, V any] struct {
+	mu          sync.Mutex
+	dir         string
+	codec       DiskCodec[K, V]
+	files       *store[string, int] // entry file names to sizes, in lru order, bound by MaxBytes.
+	hits        int64
+	corruptions int64
+	errs        int64
+}
+
+func newDiskStore[K comparable, V any](opts DiskStoreOptions[K, V]) (*diskStore[K, V], error) {
+	if opts.Dir == "" {
+		return nil, errors.New("DiskStore.Dir must not be empty")
+	}
+	if opts.MaxBytes < 0 {
+		return nil, fmt.Errorf("DiskStore.MaxBytes must be >= 0, instead got: %d", opts.MaxBytes)
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	d := &diskStore[K, V]{
+		dir:   opts.Dir,
+		codec: opts.Codec,
+		files: newStore[string, int](maths.MaxIntValue-1, newLRUPolicy[string, int]()),
+	}
+	if d.codec == nil {
+		d.codec = GobDiskCodec[K, V]{}
+	}
+	d.files.weigher = func(name string, size int) int { return size }
+	d.files.maxWeight = opts.MaxBytes
+	if d.files.maxWeight == 0 {
+		d.files.maxWeight = defaultDiskMaxBytes
+	}
+	d.files.onEvict = func(e *entry[string, int]) {
+		d.removeFile(e.key)
+	}
+	return d, d.scan()
+}
+
+// scan indexes the entry files already in the directory, oldest first so they are the first to go.
+func (d *diskStore[K, V]) scan() error {
+	dirEntries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	type file struct {
+		name    string
+		size    int
+		modTime time.Time
+	}
+	var files []file
+	for _, de := range dirEntries {
+		switch {
+		case strings.HasSuffix(de.Name(), diskTempExt):
+			// left behind by an interrupted write.
+			d.removeFile(de.Name())
+		case strings.HasSuffix(de.Name(), diskEntryExt):
+			info, err := de.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, file{name: de.Name(), size: int(info.Size()), modTime: info.ModTime()})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		d.files.add(f.name, f.size, f.modTime)
+	}
+	return nil
+}
+
+func (d *diskStore[K, V]) removeFile(name string) {
+	if err := os.Remove(filepath.Join(d.dir, name)); err != nil && !os.IsNotExist(err) {
+		d.errs++
+	}
+}
+
+func diskEntryName(encodedKey []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(encodedKey)
+	return fmt.Sprintf("%016x%s", h.Sum64(), diskEntryExt)
+}
+
+// put stores the entry into a file, replacing the existing file of the key, if any.
+func (d *diskStore[K, V]) put(key K, val V, writeTime time.Time) {
+	d.putIf(key, val, writeTime, nil)
+}
+
+// putIf is put, unless valid (if not nil) returns false. valid is called with d.mu held, so that the
+// entry is never stored after a remove (or clear or removeIf) that happens once valid turns false.
+func (d *diskStore[K, V]) putIf(key K, val V, writeTime time.Time, valid func() bool) {
+	k, err := d.codec.EncodeKey(key)
+	if err != nil {
+		d.countErr()
+		return
+	}
+	v, err := d.codec.EncodeValue(val)
+	if err != nil {
+		d.countErr()
+		return
+	}
+	data := make([]byte, diskEntryHeaderLen, diskEntryHeaderLen+len(k)+len(v))
+	copy(data, diskEntryMagic[:])
+	binary.LittleEndian.PutUint64(data[8:], uint64(writeTime.UnixNano()))
+	binary.LittleEndian.PutUint32(data[16:], uint32(len(k)))
+	data = append(append(data, k...), v...)
+	binary.LittleEndian.PutUint32(data[4:], crc32.Checksum(data[8:], crc32Table))
+
+	name := diskEntryName(k)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if valid != nil && !valid() {
+		return
+	}
+	// write to a temp file first then rename, so a crash never leaves a partially written entry file.
+	tmp := filepath.Join(d.dir, name+diskTempExt)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		d.errs++
+		d.removeFile(name + diskTempExt)
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(d.dir, name)); err != nil {
+		d.errs++
+		d.removeFile(name + diskTempExt)
+		return
+	}
+	d.files.add(name, len(data), writeTime)
+}
+
+func (d *diskStore[K, V]) countErr() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errs++
+}
+
+// readLocked reads and verifies an entry file. A corrupted entry file is deleted.
+func (d *diskStore[K, V]) readLocked(e *entry[string, int]) (key []byte, val []byte, writeTime time.Time, err error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, e.key))
+	if err != nil {
+		d.errs++
+		d.files.remove(e)
+		return nil, nil, time.Time{}, err
+	}
+	if len(data) < diskEntryHeaderLen ||
+		!bytes.Equal(data[:4], diskEntryMagic[:]) ||
+		binary.LittleEndian.Uint32(data[4:]) != crc32.Checksum(data[8:], crc32Table) ||
+		uint64(binary.LittleEndian.Uint32(data[16:])) > uint64(len(data)-diskEntryHeaderLen) {
+		d.corruptions++
+		d.files.remove(e)
+		d.removeFile(e.key)
+		return nil, nil, time.Time{}, errDiskEntryCorrupted
+	}
+	keyLen := int(binary.LittleEndian.Uint32(data[16:]))
+	writeTime = time.Unix(0, int64(binary.LittleEndian.Uint64(data[8:])))
+	return data[diskEntryHeaderLen : diskEntryHeaderLen+keyLen], data[diskEntryHeaderLen+keyLen:], writeTime, nil
+}
+
+// take returns the entry of the key and deletes it from the disk, as it's about to be moved back into
+// the memory.
+func (d *diskStore[K, V]) take(key K) (V, time.Time, bool) {
+	var zero V
+	k, err := d.codec.EncodeKey(key)
+	if err != nil {
+		d.countErr()
+		return zero, time.Time{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, found := d.files.get(diskEntryName(k))
+	if !found {
+		return zero, time.Time{}, false
+	}
+	storedKey, v, writeTime, err := d.readLocked(e)
+	if err != nil {
+		return zero, time.Time{}, false
+	}
+	if !bytes.Equal(storedKey, k) {
+		// a different key that happens to have the same file name; leave it alone.
+		return zero, time.Time{}, false
+	}
+	d.files.remove(e)
+	d.removeFile(e.key)
+	val, err := d.codec.DecodeValue(v)
+	if err != nil {
+		d.corruptions++
+		return zero, time.Time{}, false
+	}
+	d.hits++
+	return val, writeTime, true
+}
+
+// remove deletes the entry of the key from the disk, if any.
+func (d *diskStore[K, V]) remove(key K) {
+	k, err := d.codec.EncodeKey(key)
+	if err != nil {
+		d.countErr()
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, found := d.files.get(diskEntryName(k)); found {
+		d.files.remove(e)
+		d.removeFile(e.key)
+	}
+}
+
+// removeIf deletes all the entries for which pred returns true. Corrupted entries are deleted as well.
+func (d *diskStore[K, V]) removeIf(pred func(key K, val V) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.files.entries {
+		k, v, _, err := d.readLocked(e)
+		if err != nil {
+			continue
+		}
+		key, err := d.codec.DecodeKey(k)
+		if err != nil {
+			d.corruptions++
+			d.files.remove(e)
+			d.removeFile(e.key)
+			continue
+		}
+		val, err := d.codec.DecodeValue(v)
+		if err != nil {
+			d.corruptions++
+			d.files.remove(e)
+			d.removeFile(e.key)
+			continue
+		}
+		if pred(key, val) {
+			d.files.remove(e)
+			d.removeFile(e.key)
+		}
+	}
+}
+
+// clear deletes all the entries from the disk.
+func (d *diskStore[K, V]) clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.files.entries {
+		d.files.remove(e)
+		d.removeFile(e.key)
+	}
+}
+
+func (d *diskStore[K, V]) snapshotStats(st *LoadingCacheStats) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st.DiskHits = d.hits
+	st.DiskCorruptions = d.corruptions
+	st.DiskErrors = d.errs
+	st.DiskBytes = d.files.totalWeight
+}
@@ -0,0 +1,416 @@
+package caches
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/testlib"
+)
+
+func TestGobDiskCodec(t *testing.T) {
+	codec := GobDiskCodec[string, []int]{}
+	k, err := codec.EncodeKey("key")
+	assert.NoError(t, err)
+	k2, err := codec.EncodeKey("key")
+	assert.NoError(t, err)
+	assert.Equal(t, k, k2)
+	key, err := codec.DecodeKey(k)
+	assert.NoError(t, err)
+	assert.Equal(t, "key", key)
+
+	v, err := codec.EncodeValue([]int{1, 2, 3})
+	assert.NoError(t, err)
+	val, err := codec.DecodeValue(v)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, val)
+	_, err = codec.DecodeValue([]byte("garbage"))
+	assert.Error(t, err)
+
+	_, err = GobDiskCodec[string, interface{}]{}.EncodeValue(struct{ C chan int }{})
+	assert.Error(t, err)
+}
+
+func diskFilesForTest(t *testing.T, dir string) []string {
+	des, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, de := range des {
+		names = append(names, de.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newDiskStoreForTest(t *testing.T, dir string, maxBytes int64) *diskStore[string, string] {
+	d, err := newDiskStore(DiskStoreOptions[string, string]{Dir: dir, MaxBytes: maxBytes})
+	assert.NoError(t, err)
+	return d
+}
+
+func TestNewDiskStore(t *testing.T) {
+	_, err := newDiskStore(DiskStoreOptions[string, string]{})
+	assert.EqualError(t, err, "DiskStore.Dir must not be empty")
+	_, err = newDiskStore(DiskStoreOptions[string, string]{Dir: t.TempDir(), MaxBytes: -1})
+	assert.EqualError(t, err, "DiskStore.MaxBytes must be >= 0, instead got: -1")
+	f, err := os.CreateTemp(t.TempDir(), "file")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	_, err = newDiskStore(DiskStoreOptions[string, string]{Dir: filepath.Join(f.Name(), "dir")})
+	assert.Error(t, err)
+
+	d := newDiskStoreForTest(t, filepath.Join(t.TempDir(), "a", "b"), 0)
+	assert.Equal(t, int64(defaultDiskMaxBytes), d.files.maxWeight)
+	assert.IsType(t, GobDiskCodec[string, string]{}, d.codec)
+}
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newDiskStoreForTest(t, dir, 0)
+	d.put("a", "alpha", now)
+	d.put("b", "beta", now)
+	d.put("c", "gamma", now)
+	assert.Equal(t, 3, len(diskFilesForTest(t, dir)))
+
+	v, writeTime, found := d.take("a")
+	assert.True(t, found)
+	assert.Equal(t, "alpha", v)
+	assert.True(t, now.Equal(writeTime))
+	// taken entries are gone from the disk.
+	_, _, found = d.take("a")
+	assert.False(t, found)
+	assert.Equal(t, 2, len(diskFilesForTest(t, dir)))
+
+	d.remove("b")
+	d.remove("non-existing")
+	_, _, found = d.take("b")
+	assert.False(t, found)
+
+	d.put("d", "delta", now)
+	d.put("e", "epsilon", now)
+	d.removeIf(func(key, val string) bool { return key == "c" || val == "epsilon" })
+	assert.Equal(t, 1, len(diskFilesForTest(t, dir)))
+	_, _, found = d.take("d")
+	assert.True(t, found)
+
+	d.put("f", "phi", now)
+	d.put("g", "gamma", now)
+	d.clear()
+	assert.Equal(t, 0, len(diskFilesForTest(t, dir)))
+
+	d.putIf("h", "eta", now, func() bool { return false })
+	assert.Equal(t, 0, len(diskFilesForTest(t, dir)))
+	d.putIf("h", "eta", now, func() bool { return true })
+	assert.Equal(t, 1, len(diskFilesForTest(t, dir)))
+	d.clear()
+
+	var st LoadingCacheStats
+	d.snapshotStats(&st)
+	assert.Equal(t, LoadingCacheStats{DiskHits: 2}, st)
+}
+
+func TestDiskStore_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newDiskStoreForTest(t, dir, 1)
+	entrySize := func() int64 {
+		var st LoadingCacheStats
+		d.snapshotStats(&st)
+		return st.DiskBytes
+	}
+	// a single entry over the limit isn't kept.
+	d.put("a", "alpha", now)
+	assert.Equal(t, 0, len(diskFilesForTest(t, dir)))
+	assert.Equal(t, int64(0), entrySize())
+
+	d = newDiskStoreForTest(t, dir, 1<<20)
+	d.put("a", "a", now)
+	size := entrySize()
+	d = newDiskStoreForTest(t, t.TempDir(), 3*size)
+	for i := 0; i < 5; i++ {
+		d.put(strconv.Itoa(i), "a", now)
+	}
+	assert.Equal(t, 3*size, entrySize())
+	for i, expected := range []bool{false, false, true, true, true} {
+		_, _, found := d.take(strconv.Itoa(i))
+		assert.Equal(t, expected, found, i)
+	}
+}
+
+func TestDiskStore_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newDiskStoreForTest(t, dir, 0)
+	d.put("a", "aaaa", now)
+	d.put("b", "bbbb", now)
+	d.put("c", "cccc", now)
+	// the lru order upon reopening follows the file modification times: b, c, a.
+	for key, age := range map[string]time.Duration{"a": time.Second, "b": time.Hour, "c": time.Minute} {
+		k, _ := d.codec.EncodeKey(key)
+		modTime := time.Now().Add(-age)
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, diskEntryName(k)), modTime, modTime))
+	}
+	var st LoadingCacheStats
+	d.snapshotStats(&st)
+	// a left-over temp file is cleaned up; other files are left alone.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "x"+diskTempExt), nil, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "unrelated"), nil, 0644))
+
+	d = newDiskStoreForTest(t, dir, st.DiskBytes)
+	assert.Equal(t, 4, len(diskFilesForTest(t, dir)))
+	// b is now the oldest, thus the first to go.
+	d.put("d", "dddd", now)
+	_, _, found := d.take("b")
+	assert.False(t, found)
+	for _, key := range []string{"a", "c", "d"} {
+		_, _, found = d.take(key)
+		assert.True(t, found, key)
+	}
+	assert.Equal(t, []string{"unrelated"}, diskFilesForTest(t, dir))
+}
+
+func TestDiskStore_Corruption(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{
+			name:    "truncated header",
+			corrupt: func(data []byte) []byte { return data[:diskEntryHeaderLen-1] },
+		},
+		{
+			name:    "truncated payload",
+			corrupt: func(data []byte) []byte { return data[:len(data)-1] },
+		},
+		{
+			name: "bad magic",
+			corrupt: func(data []byte) []byte {
+				data[0] = 'X'
+				return data
+			},
+		},
+		{
+			name: "bit flip",
+			corrupt: func(data []byte) []byte {
+				data[len(data)-1] ^= 1
+				return data
+			},
+		},
+		{
+			name:    "empty",
+			corrupt: func(data []byte) []byte { return nil },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := newDiskStoreForTest(t, dir, 0)
+			d.put("a", "alpha", time.Now())
+			files := diskFilesForTest(t, dir)
+			assert.Equal(t, 1, len(files))
+			file := filepath.Join(dir, files[0])
+			data, err := os.ReadFile(file)
+			assert.NoError(t, err)
+			assert.NoError(t, os.WriteFile(file, test.corrupt(data), 0644))
+
+			_, _, found := d.take("a")
+			assert.False(t, found)
+			// the corrupted entry is deleted.
+			assert.Equal(t, 0, len(diskFilesForTest(t, dir)))
+			var st LoadingCacheStats
+			d.snapshotStats(&st)
+			assert.Equal(t, LoadingCacheStats{DiskCorruptions: 1}, st)
+		})
+	}
+}
+
+func TestDiskStore_Corruption_RemoveIf(t *testing.T) {
+	dir := t.TempDir()
+	d := newDiskStoreForTest(t, dir, 0)
+	d.put("a", "alpha", time.Now())
+	files := diskFilesForTest(t, dir)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, files[0]), []byte("garbage"), 0644))
+	d.removeIf(func(key, val string) bool { return false })
+	assert.Equal(t, 0, len(diskFilesForTest(t, dir)))
+	var st LoadingCacheStats
+	d.snapshotStats(&st)
+	assert.Equal(t, int64(1), st.DiskCorruptions)
+}
+
+func TestDiskStore_KeyCollision(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	d := newDiskStoreForTest(t, dir, 0)
+	d.put("a", "alpha", now)
+	aFile := diskFilesForTest(t, dir)[0]
+	d.remove("a")
+	d.put("b", "beta", now)
+	// pretend b's entry is stored in the file of a.
+	bFile := diskFilesForTest(t, dir)[0]
+	assert.NoError(t, os.Rename(filepath.Join(dir, bFile), filepath.Join(dir, aFile)))
+	d = newDiskStoreForTest(t, dir, 0)
+	_, _, found := d.take("a")
+	assert.False(t, found)
+	// the entry of b is left alone.
+	assert.Equal(t, []string{aFile}, diskFilesForTest(t, dir))
+}
+
+type failingDiskCodecForTest struct {
+	GobDiskCodec[string, string]
+}
+
+func (failingDiskCodecForTest) EncodeKey(key string) ([]byte, error) {
+	if key == "bad" {
+		return nil, errors.New("bad key")
+	}
+	return []byte(key), nil
+}
+
+func (failingDiskCodecForTest) EncodeValue(val string) ([]byte, error) {
+	if val == "bad" {
+		return nil, errors.New("bad value")
+	}
+	return []byte(val), nil
+}
+
+func (failingDiskCodecForTest) DecodeValue(data []byte) (string, error) {
+	if string(data) == "undecodable" {
+		return "", errors.New("undecodable")
+	}
+	return string(data), nil
+}
+
+func TestDiskStore_CodecErrors(t *testing.T) {
+	d, err := newDiskStore(DiskStoreOptions[string, string]{Dir: t.TempDir(), Codec: failingDiskCodecForTest{}})
+	assert.NoError(t, err)
+	d.put("bad", "v", time.Now())
+	d.put("k", "bad", time.Now())
+	_, _, found := d.take("bad")
+	assert.False(t, found)
+	d.remove("bad")
+	d.put("k", "undecodable", time.Now())
+	_, _, found = d.take("k")
+	assert.False(t, found)
+	var st LoadingCacheStats
+	d.snapshotStats(&st)
+	assert.Equal(t, int64(4), st.DiskErrors)
+	assert.Equal(t, int64(1), st.DiskCorruptions)
+}
+
+func TestTypedLoadingCache_DiskStore(t *testing.T) {
+	dir := t.TempDir()
+	clock := newMockClock()
+	newCache := func() *TypedLoadingCache[string, int] {
+		return NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+			Capacity:         testlib.IntPtr(2),
+			ExpireAfterWrite: time.Hour,
+			DiskStore:        &DiskStoreOptions[string, int]{Dir: dir},
+			Clock:            clock,
+		})
+	}
+	c := newCache()
+	loads := 0
+	load := func(key string) (int, error) {
+		loads++
+		return strconv.Atoi(key)
+	}
+	for _, key := range []string{"1", "2", "3"} {
+		_, _ = c.Get(key, load)
+	}
+	// 1 is evicted from the memory to the disk, then moved back without calling load.
+	assert.Equal(t, map[string]int{"2": 2, "3": 3}, c.DumpForTest())
+	v, err := c.Get("1", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 3, loads)
+	st := c.Stats()
+	assert.Equal(t, int64(1), st.DiskHits)
+	assert.Equal(t, int64(3), st.LoadSuccesses)
+	assert.Equal(t, int64(4), st.Misses)
+	assert.Equal(t, int64(2), st.Evictions)
+
+	// 2 is on the disk now; GetAll takes it from there as well.
+	vals, err := c.GetAll([]string{"2", "4"}, func(keys []string) (map[string]int, error) {
+		assert.Equal(t, []string{"4"}, keys)
+		return map[string]int{"4": 4}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2": 2, "4": 4}, vals)
+	assert.Equal(t, int64(2), c.Stats().DiskHits)
+
+	// invalidated values are removed from the disk as well.
+	c.Invalidate("1") // 1 is on the disk.
+	c.Put("3", 30)    // 3 is on the disk.
+	_, _ = c.Get("1", load)
+	assert.Equal(t, 4, loads)
+
+	// values survive a restart once flushed to disk.
+	c.FlushToDisk()
+	c = newCache()
+	loads = 0
+	for _, key := range []string{"1", "3"} {
+		_, _ = c.Get(key, load)
+	}
+	assert.Equal(t, 0, loads)
+	assert.Equal(t, map[string]int{"1": 1, "3": 30}, c.DumpForTest())
+
+	// expiration still applies to values on the disk.
+	c.FlushToDisk()
+	clock.Advance(time.Hour)
+	c = newCache()
+	_, _ = c.Get("1", load)
+	assert.Equal(t, 1, loads)
+
+	c.InvalidateIf(func(key string, val int) bool { return val == 30 })
+	c.InvalidateAll()
+	assert.Equal(t, 0, len(diskFilesForTest(t, dir)))
+	NewTypedLoadingCache[string, int]().FlushToDisk()
+}
+
+func TestTypedLoadingCache_DiskStore_InvalidateRacingEviction(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		invalidate func(c *TypedLoadingCache[string, int])
+	}{
+		{name: "Invalidate", invalidate: func(c *TypedLoadingCache[string, int]) { c.Invalidate("a") }},
+		{name: "InvalidateAll", invalidate: func(c *TypedLoadingCache[string, int]) { c.InvalidateAll() }},
+		{name: "InvalidateIf", invalidate: func(c *TypedLoadingCache[string, int]) {
+			c.InvalidateIf(func(key string, val int) bool { return key == "a" })
+		}},
+		{name: "Put", invalidate: func(c *TypedLoadingCache[string, int]) { c.Put("a", 100) }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+				Capacity:  testlib.IntPtr(1),
+				DiskStore: &DiskStoreOptions[string, int]{Dir: t.TempDir()},
+			})
+			_, _ = c.Get("a", func(string) (int, error) { return 1, nil })
+			// a is evicted, but the invalidation happens before a is written to the disk.
+			s := c.segments[0]
+			s.mu.Lock()
+			s.addLocked("b", 2)
+			evicted := s.takeEvictedLocked()
+			s.mu.Unlock()
+			assert.Equal(t, 1, len(evicted))
+			test.invalidate(c)
+			s.notifyEvicted(evicted)
+			_, _, found := c.disk.take("a")
+			assert.False(t, found)
+			v, err := c.Get("a", func(string) (int, error) { return 100, nil })
+			assert.NoError(t, err)
+			assert.Equal(t, 100, v)
+		})
+	}
+}
+
+func TestTypedLoadingCache_DiskStore_InvalidDir(t *testing.T) {
+	assert.PanicsWithError(t, "DiskStore.Dir must not be empty", func() {
+		NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{DiskStore: &DiskStoreOptions[string, int]{}})
+	})
+}
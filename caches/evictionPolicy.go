@@ -0,0 +1,177 @@
+package caches
+
+import (
+	"fmt"
+)
+
+// EvictionPolicy decides which values a LoadingCache evicts when it's over its capacity or max weight.
+type EvictionPolicy int
+
+const (
+	// EvictionPolicyLRU evicts the least recently used value. It's the default policy.
+	EvictionPolicyLRU EvictionPolicy = iota
+	// EvictionPolicyLFU evicts the least frequently used value; ties are broken in LRU fashion.
+	EvictionPolicyLFU
+	// EvictionPolicyARC is the Adaptive Replacement Cache policy, which balances between recency and
+	// frequency by tracking recently evicted keys, adapting itself to the workload.
+	EvictionPolicyARC
+	// EvictionPolicy2Q is the 2Q policy, which admits new values into a small FIFO queue first and only
+	// promotes them into the main LRU queue if they're requested again after being evicted from the
+	// FIFO queue, thus protecting the hot values from one-off scans.
+	EvictionPolicy2Q
+	// EvictionPolicyWTinyLFU is the Window TinyLFU policy: new values enter a small LRU window, and
+	// only get admitted into the main (segmented LRU) area if their estimated access frequency is higher
+	// than that of the main area's eviction candidate. It's highly resistant to scans and one-off keys.
+	EvictionPolicyWTinyLFU
+)
+
+// String implements fmt.Stringer interface for EvictionPolicy.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictionPolicyLRU:
+		return "LRU"
+	case EvictionPolicyLFU:
+		return "LFU"
+	case EvictionPolicyARC:
+		return "ARC"
+	case EvictionPolicy2Q:
+		return "2Q"
+	case EvictionPolicyWTinyLFU:
+		return "W-TinyLFU"
+	default:
+		return "unknown"
+	}
+}
+
+// policy does the bookkeeping of the entries of a store and decides the eviction order. Not thread-safe.
+type policy[K comparable, V any] interface {
+	// add is called when a new entry is stored.
+	add(e *entry[K, V])
+	// access is called when an existing entry is read or updated.
+	access(e *entry[K, V])
+	// remove is called when an entry is removed for reasons other than eviction.
+	remove(e *entry[K, V])
+	// victim picks the entry to evict, drops it from the policy's bookkeeping and returns it. Only
+	// called when there is at least one entry.
+	victim() *entry[K, V]
+}
+
+func newPolicy[K comparable, V any](p EvictionPolicy, capacity int, hasher func(K) uint64) policy[K, V] {
+	switch p {
+	case EvictionPolicyLRU:
+		return newLRUPolicy[K, V]()
+	case EvictionPolicyLFU:
+		return newLFUPolicy[K, V]()
+	case EvictionPolicyARC:
+		return newARCPolicy[K, V](capacity)
+	case EvictionPolicy2Q:
+		return newTwoQueuePolicy[K, V](capacity)
+	case EvictionPolicyWTinyLFU:
+		return newTinyLFUPolicy[K, V](capacity, hasher)
+	default:
+		panic(fmt.Errorf("unknown EvictionPolicy: %d", int(p)))
+	}
+}
+
+type lruPolicy[K comparable, V any] struct {
+	l *entryList[K, V]
+}
+
+func newLRUPolicy[K comparable, V any]() *lruPolicy[K, V] {
+	return &lruPolicy[K, V]{l: newEntryList[K, V]()}
+}
+
+func (p *lruPolicy[K, V]) add(e *entry[K, V]) {
+	p.l.pushFront(e)
+}
+
+func (p *lruPolicy[K, V]) access(e *entry[K, V]) {
+	p.l.moveToFront(e)
+}
+
+func (p *lruPolicy[K, V]) remove(e *entry[K, V]) {
+	p.l.remove(e)
+}
+
+func (p *lruPolicy[K, V]) victim() *entry[K, V] {
+	e := p.l.back()
+	p.l.remove(e)
+	return e
+}
+
+// lfuPolicy keeps entries in per-frequency LRU lists, so all operations are O(1), except victim which
+// might need to scan for the lowest frequency after the least frequently used entries are removed.
+type lfuPolicy[K comparable, V any] struct {
+	buckets map[int]*entryList[K, V]
+	minFreq int
+	newest  *entry[K, V] // the most recently added entry.
+}
+
+func newLFUPolicy[K comparable, V any]() *lfuPolicy[K, V] {
+	return &lfuPolicy[K, V]{buckets: make(map[int]*entryList[K, V])}
+}
+
+func (p *lfuPolicy[K, V]) push(e *entry[K, V]) {
+	b, found := p.buckets[e.freq]
+	if !found {
+		b = newEntryList[K, V]()
+		p.buckets[e.freq] = b
+	}
+	b.pushFront(e)
+}
+
+func (p *lfuPolicy[K, V]) unlink(e *entry[K, V]) {
+	b := p.buckets[e.freq]
+	b.remove(e)
+	if b.len() == 0 {
+		delete(p.buckets, e.freq)
+	}
+}
+
+func (p *lfuPolicy[K, V]) add(e *entry[K, V]) {
+	p.newest = e
+	e.freq = 1
+	p.push(e)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy[K, V]) access(e *entry[K, V]) {
+	p.unlink(e)
+	if p.minFreq == e.freq && p.buckets[e.freq] == nil {
+		p.minFreq++
+	}
+	e.freq++
+	p.push(e)
+}
+
+func (p *lfuPolicy[K, V]) remove(e *entry[K, V]) {
+	p.unlink(e)
+}
+
+func (p *lfuPolicy[K, V]) victim() *entry[K, V] {
+	b, found := p.buckets[p.minFreq]
+	if !found {
+		// minFreq went stale due to removals; find the actual lowest frequency.
+		p.minFreq = 0
+		for f, fb := range p.buckets {
+			if p.minFreq == 0 || f < p.minFreq {
+				p.minFreq, b = f, fb
+			}
+		}
+	}
+	e := b.back()
+	if e == p.newest && b.len() == 1 && len(p.buckets) > 1 {
+		// A store adds an entry first and then asks for a victim; a newly added entry always has the
+		// lowest frequency, but evicting it right away would keep any new entry from ever getting in.
+		// So pick the least frequently used one among the rest.
+		next := 0
+		for f := range p.buckets {
+			if f != e.freq && (next == 0 || f < next) {
+				next = f
+			}
+		}
+		e = p.buckets[next].back()
+	}
+	p.unlink(e)
+	return e
+}
@@ -0,0 +1,272 @@
+package caches
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/testlib"
+)
+
+func TestEvictionPolicy_String(t *testing.T) {
+	assert.Equal(t, "LRU", EvictionPolicyLRU.String())
+	assert.Equal(t, "LFU", EvictionPolicyLFU.String())
+	assert.Equal(t, "ARC", EvictionPolicyARC.String())
+	assert.Equal(t, "2Q", EvictionPolicy2Q.String())
+	assert.Equal(t, "W-TinyLFU", EvictionPolicyWTinyLFU.String())
+	assert.Equal(t, "unknown", EvictionPolicy(99).String())
+}
+
+func TestNewPolicy(t *testing.T) {
+	assert.IsType(t, &lruPolicy[string, int]{}, newPolicy[string, int](EvictionPolicyLRU, 10, defaultHasher[string]))
+	assert.IsType(t, &lfuPolicy[string, int]{}, newPolicy[string, int](EvictionPolicyLFU, 10, defaultHasher[string]))
+	assert.IsType(t, &arcPolicy[string, int]{}, newPolicy[string, int](EvictionPolicyARC, 10, defaultHasher[string]))
+	assert.IsType(t,
+		&twoQueuePolicy[string, int]{}, newPolicy[string, int](EvictionPolicy2Q, 10, defaultHasher[string]))
+	assert.IsType(t,
+		&tinyLFUPolicy[string, int]{}, newPolicy[string, int](EvictionPolicyWTinyLFU, 10, defaultHasher[string]))
+	assert.PanicsWithError(t, "unknown EvictionPolicy: 99", func() {
+		newPolicy[string, int](EvictionPolicy(99), 10, defaultHasher[string])
+	})
+	assert.PanicsWithError(t, "unknown EvictionPolicy: -1", func() {
+		NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{EvictionPolicy: -1})
+	})
+}
+
+// policyStoreForTest is a store driven the way a segment drives it: a hit touches the entry, a miss
+// adds it.
+type policyStoreForTest struct {
+	*store[string, int]
+	evicted []string
+}
+
+func newPolicyStoreForTest(p EvictionPolicy, capacity int) *policyStoreForTest {
+	s := &policyStoreForTest{
+		store: newStore[string, int](capacity, newPolicy[string, int](p, capacity, defaultHasher[string])),
+	}
+	s.onEvict = func(e *entry[string, int]) { s.evicted = append(s.evicted, e.key) }
+	return s
+}
+
+func (s *policyStoreForTest) access(keys ...string) {
+	for _, key := range keys {
+		if e, found := s.get(key); found {
+			s.touch(e)
+			continue
+		}
+		s.add(key, 0, time.Time{})
+	}
+}
+
+func (s *policyStoreForTest) has(keys ...string) bool {
+	for _, key := range keys {
+		if _, found := s.get(key); !found {
+			return false
+		}
+	}
+	return true
+}
+
+func scanKeys(prefix string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = prefix + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func TestLRUPolicy(t *testing.T) {
+	s := newPolicyStoreForTest(EvictionPolicyLRU, 3)
+	s.access("a", "b", "c", "a", "d")
+	assert.Equal(t, []string{"b"}, s.evicted)
+	s.access("e")
+	assert.Equal(t, []string{"b", "c"}, s.evicted)
+	assert.True(t, s.has("a", "d", "e"))
+}
+
+func TestLFUPolicy(t *testing.T) {
+	s := newPolicyStoreForTest(EvictionPolicyLFU, 3)
+	s.access("a", "a", "a", "b", "c", "c", "d")
+	// b is the least frequently used.
+	assert.Equal(t, []string{"b"}, s.evicted)
+	// d (freq 1) is now the least frequently used; ties are broken in LRU fashion.
+	s.access("e")
+	assert.Equal(t, []string{"b", "d"}, s.evicted)
+	s.access("e", "e", "e")
+	assert.Equal(t, 4, s.entries["e"].freq)
+
+	// removing the least frequently used entries makes minFreq stale; victim must still find the
+	// lowest frequency.
+	s.remove(s.entries["c"])
+	s.access("f")
+	assert.Equal(t, []string{"b", "d"}, s.evicted)
+	s.access("g")
+	assert.Equal(t, []string{"b", "d", "f"}, s.evicted)
+	p := s.policy.(*lfuPolicy[string, int])
+	p.minFreq = 100
+	s.access("h")
+	assert.Equal(t, []string{"b", "d", "f", "g"}, s.evicted)
+	assert.True(t, s.has("a", "e", "h"))
+
+	// a new entry is the least frequently used one by definition, but it's never evicted right away:
+	// the least frequently used among the rest is evicted instead.
+	s.access("h")
+	s.access("i")
+	assert.Equal(t, []string{"b", "d", "f", "g", "h"}, s.evicted)
+	assert.True(t, s.has("a", "e", "i"))
+}
+
+func TestLoadingCache_EvictionPolicy(t *testing.T) {
+	for _, policy := range []EvictionPolicy{
+		EvictionPolicyLRU, EvictionPolicyLFU, EvictionPolicyARC, EvictionPolicy2Q, EvictionPolicyWTinyLFU,
+	} {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[int, int]{
+				Capacity:       testlib.IntPtr(100),
+				EvictionPolicy: policy,
+			})
+			for i := 0; i < 1000; i++ {
+				v, err := c.Get(i%300, func(key int) (int, error) { return key * 2, nil })
+				assert.NoError(t, err)
+				assert.Equal(t, (i%300)*2, v)
+			}
+			s := c.Stats()
+			assert.Equal(t, 100, s.Size)
+			assert.Equal(t, int64(1000), s.Hits+s.Misses)
+			assert.Equal(t, s.Misses-100, s.Evictions)
+		})
+	}
+}
+
+// Hit-rate harness: key traces recorded under testdata/traces (gzipped, one key per line) are replayed
+// against a cache under each eviction policy. Run
+//
+//	go test ./caches -run NONE -bench HitRate
+//
+// to see the hit rate ("hit%") of each policy on each trace. To add a trace, drop its .trace.gz file
+// into testdata/traces. The synthetic traces checked in are generated by TestGenerateTraces.
+
+const (
+	tracesDir          = "testdata/traces"
+	hitRateCapacity    = 1000
+	updateTracesEnvVar = "CACHES_UPDATE_TRACES"
+)
+
+var allEvictionPolicies = []EvictionPolicy{
+	EvictionPolicyLRU, EvictionPolicyLFU, EvictionPolicyARC, EvictionPolicy2Q, EvictionPolicyWTinyLFU,
+}
+
+func readTraceForTest(t testing.TB, name string) []string {
+	f, err := os.Open(filepath.Join(tracesDir, name))
+	assert.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		keys = append(keys, scanner.Text())
+	}
+	assert.NoError(t, scanner.Err())
+	return keys
+}
+
+func replayTraceForTest(policy EvictionPolicy, keys []string) float64 {
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, struct{}]{
+		Capacity:       testlib.IntPtr(hitRateCapacity),
+		EvictionPolicy: policy,
+	})
+	load := func(string) (struct{}, error) { return struct{}{}, nil }
+	for _, key := range keys {
+		_, _ = c.Get(key, load)
+	}
+	return c.Stats().HitRate()
+}
+
+func BenchmarkHitRate(b *testing.B) {
+	traces, err := filepath.Glob(filepath.Join(tracesDir, "*.trace.gz"))
+	assert.NoError(b, err)
+	for _, trace := range traces {
+		keys := readTraceForTest(b, filepath.Base(trace))
+		for _, policy := range allEvictionPolicies {
+			b.Run(fmt.Sprintf("%s/%s", filepath.Base(trace), policy), func(b *testing.B) {
+				hitRate := 0.0
+				for i := 0; i < b.N; i++ {
+					hitRate = replayTraceForTest(policy, keys)
+				}
+				b.ReportMetric(hitRate*100, "hit%")
+			})
+		}
+	}
+}
+
+func TestHitRate_ScanResistance(t *testing.T) {
+	keys := readTraceForTest(t, "zipfWithScans.trace.gz")
+	lru := replayTraceForTest(EvictionPolicyLRU, keys)
+	for _, policy := range []EvictionPolicy{EvictionPolicyARC, EvictionPolicy2Q, EvictionPolicyWTinyLFU} {
+		assert.Greater(t, replayTraceForTest(policy, keys), lru, policy.String())
+	}
+}
+
+func writeTraceForTest(t *testing.T, name string, keys []string) {
+	f, err := os.Create(filepath.Join(tracesDir, name))
+	assert.NoError(t, err)
+	defer f.Close()
+	w, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	assert.NoError(t, err)
+	bw := bufio.NewWriter(w)
+	for _, key := range keys {
+		_, _ = bw.WriteString(key)
+		_ = bw.WriteByte('\n')
+	}
+	assert.NoError(t, bw.Flush())
+	assert.NoError(t, w.Close())
+}
+
+// TestGenerateTraces regenerates the synthetic traces, only if env var CACHES_UPDATE_TRACES is set.
+func TestGenerateTraces(t *testing.T) {
+	if os.Getenv(updateTracesEnvVar) == "" {
+		t.Skipf("set %s=1 to regenerate the traces under %s", updateTracesEnvVar, tracesDir)
+	}
+	assert.NoError(t, os.MkdirAll(tracesDir, 0755))
+	const n = 50000
+	r := rand.New(rand.NewSource(1))
+
+	// zipf: a skewed popularity distribution over 10x as many keys as the cache capacity.
+	zipf := rand.NewZipf(r, 1.1, 1, 10*hitRateCapacity-1)
+	keys := make([]string, 0, n)
+	for len(keys) < n {
+		keys = append(keys, "z"+strconv.FormatUint(zipf.Uint64(), 10))
+	}
+	writeTraceForTest(t, "zipf.trace.gz", keys)
+
+	// zipfWithScans: a small hot set, mixed with bursts of one-off keys (e.g. ad hoc regex patterns).
+	hot := rand.NewZipf(r, 1.1, 1, hitRateCapacity/2-1)
+	keys, oneOff := keys[:0], 0
+	for len(keys) < n {
+		if r.Intn(2000) == 0 {
+			for i := 0; i < hitRateCapacity && len(keys) < n; i++ {
+				keys = append(keys, "s"+strconv.Itoa(oneOff))
+				oneOff++
+			}
+			continue
+		}
+		keys = append(keys, "h"+strconv.FormatUint(hot.Uint64(), 10))
+	}
+	writeTraceForTest(t, "zipfWithScans.trace.gz", keys)
+
+	// loop: keys accessed in a loop slightly bigger than the cache capacity, LRU's worst case.
+	keys = keys[:0]
+	for i := 0; len(keys) < n; i++ {
+		keys = append(keys, "l"+strconv.Itoa(i%(hitRateCapacity+hitRateCapacity/5)))
+	}
+	writeTraceForTest(t, "loop.trace.gz", keys)
+}
@@ -0,0 +1,29 @@
+package caches
+
+import (
+	"github.com/jf-tech/go-corelib/jsons"
+)
+
+// JSONPathCache is the default loading cache used for caching the compiled JSONPath
+// expressions, i.e. the JSONPathCacheName cache of DefaultCacheRegistry. Be aware it's
+// global so any packages uses this package inside your process will be affected by replacing
+// it; to customize the cache for your own use, create a CacheRegistry instead.
+var JSONPathCache = NewLoadingCache()
+
+// GetJSONPath compiles a given JSONPath expression and returns a compiled *jsons.JSONPath
+// or error, using DefaultCacheRegistry. See jsons.JSONPath for the supported syntax.
+func GetJSONPath(expr string) (*jsons.JSONPath, error) {
+	return defaultCacheRegistry.GetJSONPath(expr)
+}
+
+// GetJSONPath compiles a given JSONPath expression and returns a compiled *jsons.JSONPath
+// or error, using the registry's JSONPathCacheName cache.
+func (r *CacheRegistry) GetJSONPath(expr string) (*jsons.JSONPath, error) {
+	path, err := r.Cache(JSONPathCacheName).Get(expr, func(key interface{}) (interface{}, error) {
+		return jsons.CompileJSONPath(key.(string))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return path.(*jsons.JSONPath), nil
+}
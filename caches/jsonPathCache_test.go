@@ -0,0 +1,41 @@
+package caches
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetJSONPath(t *testing.T) {
+	JSONPathCache = NewLoadingCache()
+	assert.Equal(t, 0, len(JSONPathCache.DumpForTest()))
+	// failure case
+	path, err := GetJSONPath("a.b")
+	assert.Error(t, err)
+	assert.Equal(t, "invalid JSONPath 'a.b' at position 0: must start with '$'", err.Error())
+	assert.Nil(t, path)
+	assert.Equal(t, 0, len(JSONPathCache.DumpForTest()))
+	// success case
+	path, err = GetJSONPath("$.a[1]")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"y"}, path.Eval(map[string]interface{}{"a": []interface{}{"x", "y"}}))
+	assert.Equal(t, 1, len(JSONPathCache.DumpForTest()))
+	// repeat success case shouldn't case any cache growth
+	path2, err := GetJSONPath("$.a[1]")
+	assert.NoError(t, err)
+	assert.True(t, path == path2)
+	assert.Equal(t, 1, len(JSONPathCache.DumpForTest()))
+}
+
+func TestCacheRegistry_GetJSONPath(t *testing.T) {
+	JSONPathCache = NewLoadingCache()
+	r := NewCacheRegistry()
+	path, err := r.GetJSONPath("$..a")
+	assert.NoError(t, err)
+	assert.NotNil(t, path)
+	_, err = r.GetJSONPath("$[")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(r.Cache(JSONPathCacheName).DumpForTest()))
+	// the registry is isolated from the default one.
+	assert.Equal(t, 0, len(JSONPathCache.DumpForTest()))
+}
@@ -0,0 +1,73 @@
+package caches
+
+import (
+	"time"
+)
+
+type entry[K comparable, V any] struct {
+	key        K
+	val        V
+	writeTime  time.Time
+	accessTime time.Time
+	hits       int
+	weight     int64
+	freq       int   // access frequency, used by the LFU policy.
+	queue      uint8 // which of the policy's queues the entry is in, for policies with multiple queues.
+	prev, next *entry[K, V]
+}
+
+// entryList is an intrusive circular doubly linked list of entries. Not thread-safe.
+type entryList[K comparable, V any] struct {
+	// root is the sentinel: root.next is the front and root.prev is the back of the list.
+	root entry[K, V]
+	n    int
+}
+
+func newEntryList[K comparable, V any]() *entryList[K, V] {
+	l := &entryList[K, V]{}
+	l.root.prev, l.root.next = &l.root, &l.root
+	return l
+}
+
+func (l *entryList[K, V]) len() int {
+	return l.n
+}
+
+// front returns the first entry of the list, or nil if the list is empty.
+func (l *entryList[K, V]) front() *entry[K, V] {
+	if l.n == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+// back returns the last entry of the list, or nil if the list is empty.
+func (l *entryList[K, V]) back() *entry[K, V] {
+	if l.n == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+func (l *entryList[K, V]) pushFront(e *entry[K, V]) {
+	e.prev = &l.root
+	e.next = l.root.next
+	e.prev.next = e
+	e.next.prev = e
+	l.n++
+}
+
+func (l *entryList[K, V]) remove(e *entry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+	l.n--
+}
+
+func (l *entryList[K, V]) moveToFront(e *entry[K, V]) {
+	if l.root.next == e {
+		return
+	}
+	l.remove(e)
+	l.pushFront(e)
+}
@@ -0,0 +1,43 @@
+package caches
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listKeysForTest[K comparable, V any](l *entryList[K, V]) []K {
+	var keys []K
+	for e := l.front(); e != nil && e != &l.root; e = e.next {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+func TestEntryList(t *testing.T) {
+	l := newEntryList[string, int]()
+	assert.Equal(t, 0, l.len())
+	assert.Nil(t, l.front())
+	assert.Nil(t, l.back())
+	assert.Nil(t, listKeysForTest(l))
+
+	a, b, c := &entry[string, int]{key: "a"}, &entry[string, int]{key: "b"}, &entry[string, int]{key: "c"}
+	l.pushFront(a)
+	l.pushFront(b)
+	l.pushFront(c)
+	assert.Equal(t, 3, l.len())
+	assert.Equal(t, []string{"c", "b", "a"}, listKeysForTest(l))
+	assert.Equal(t, c, l.front())
+	assert.Equal(t, a, l.back())
+
+	l.moveToFront(a)
+	assert.Equal(t, []string{"a", "c", "b"}, listKeysForTest(l))
+	l.moveToFront(a)
+	assert.Equal(t, []string{"a", "c", "b"}, listKeysForTest(l))
+
+	l.remove(c)
+	assert.Equal(t, 2, l.len())
+	assert.Nil(t, c.prev)
+	assert.Nil(t, c.next)
+	assert.Equal(t, []string{"a", "b"}, listKeysForTest(l))
+}
@@ -0,0 +1,97 @@
+package caches
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TypedLoadContextFunc is the type of the context-aware loading function for TypedLoadingCache.GetContext.
+type TypedLoadContextFunc[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// LoadContextFunc is the type of the context-aware loading function for LoadingCache.GetContext.
+type LoadContextFunc = TypedLoadContextFunc[interface{}, interface{}]
+
+// loader is the loading function passed into a Get (load) or a GetContext (loadCtx, along with the
+// context of the GetContext call).
+type loader[K comparable, V any] struct {
+	load    TypedLoadFunc[K, V]
+	loadCtx TypedLoadContextFunc[K, V]
+	ctx     context.Context
+}
+
+func (l loader[K, V]) call(key K, timeout time.Duration) (V, error) {
+	if l.loadCtx == nil {
+		return l.load(key)
+	}
+	ctx := context.Context(detachedContext{parent: l.ctx})
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return l.loadCtx(ctx, key)
+}
+
+// detachedContext carries the values of its parent context, but not its deadline or cancellation, so
+// that a load shared by multiple callers isn't cut short when the caller who kicked it off gives up.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// GetContext is the context-aware version of Get: if the key isn't in the cache, the load function is
+// called with a context carrying the values of ctx, and GetContext stops waiting for the load, returning
+// ctx.Err(), as soon as ctx is done. Because a load is shared by all the concurrent callers of the same
+// key, a load isn't cancelled when its callers give up: it keeps going, and its value is stored into the
+// cache once done, unless LoadTimeout (see TypedLoadingCacheOptions) cuts it short. Context errors
+// returned by the load function are never negatively cached. If ctx is already done upon the call,
+// GetContext returns ctx.Err() right away, without even looking up the cache.
+func (c *TypedLoadingCache[K, V]) GetContext(
+	ctx context.Context, key K, load TypedLoadContextFunc[K, V]) (V, error) {
+	var zero V
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	s := c.segmentOf(key)
+	l := loader[K, V]{loadCtx: load, ctx: ctx}
+	v, err, cl, owner := s.lookup(key, l)
+	if cl == nil {
+		return v, err
+	}
+	if owner {
+		if ctx.Done() == nil {
+			// ctx can never be done, so there is no need to load in a separate goroutine.
+			s.doLoad(key, l, cl)
+			return cl.result()
+		}
+		// Any panic from the load function is captured by doLoad, and re-raised below, or in any
+		// other caller waiting on the call.
+		go s.doLoad(key, l, cl)
+	}
+	select {
+	case <-cl.done:
+		return cl.result()
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,138 @@
+package caches
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKeyForTest struct{}
+
+func TestDetachedContext(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKeyForTest{}, "v"), time.Hour)
+	cancel()
+	ctx := detachedContext{parent: parent}
+	assert.Equal(t, "v", ctx.Value(ctxKeyForTest{}))
+	assert.NoError(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+}
+
+func TestIsContextErr(t *testing.T) {
+	assert.True(t, isContextErr(context.Canceled))
+	assert.True(t, isContextErr(context.DeadlineExceeded))
+	assert.True(t, isContextErr(errors.Join(errors.New("load failed"), context.DeadlineExceeded)))
+	assert.False(t, isContextErr(errors.New("load failed")))
+	assert.False(t, isContextErr(nil))
+}
+
+func TestTypedLoadingCache_GetContext(t *testing.T) {
+	c := NewTypedLoadingCache[string, int]()
+	ctx := context.WithValue(context.Background(), ctxKeyForTest{}, 42)
+	load := func(ctx context.Context, key string) (int, error) {
+		return ctx.Value(ctxKeyForTest{}).(int), nil
+	}
+	v, err := c.GetContext(ctx, "a", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	// served from the cache.
+	v, err = c.GetContext(ctx, "a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+
+	// a cancellable context: the load happens in a separate goroutine.
+	cancellable, cancel := context.WithCancel(ctx)
+	defer cancel()
+	v, err = c.GetContext(cancellable, "b", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+
+	// a context already done.
+	cancel()
+	_, err = c.GetContext(cancellable, "a", load)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, map[string]int{"a": 42, "b": 42}, c.DumpForTest())
+}
+
+func TestTypedLoadingCache_GetContext_CallerGivesUpLoadKeepsGoing(t *testing.T) {
+	c := NewTypedLoadingCache[string, int]()
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (int, error) {
+		close(loading)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	err1 := make(chan error)
+	go func() {
+		_, err := c.GetContext(ctx1, "key", load)
+		err1 <- err
+	}()
+	<-loading
+
+	// a second caller, with a deadline, waiting on the same load.
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel2()
+	_, err := c.GetContext(ctx2, "key", load)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// a third caller, without any deadline, waiting on the same load.
+	var wg sync.WaitGroup
+	var v3 int
+	var err3 error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		v3, err3 = c.Get("key", nil)
+	}()
+	waitForMisses(c, 3)
+
+	// the caller kicking off the load gives up, but the load keeps going.
+	cancel1()
+	assert.Equal(t, context.Canceled, <-err1)
+	assert.Equal(t, 0, c.Len())
+	close(release)
+	wg.Wait()
+	assert.NoError(t, err3)
+	assert.Equal(t, 1, v3)
+	assert.Equal(t, map[string]int{"key": 1}, c.DumpForTest())
+}
+
+func TestTypedLoadingCache_GetContext_LoadTimeout(t *testing.T) {
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		LoadTimeout:  time.Millisecond,
+		ErrorMaxHits: 10,
+	})
+	load := func(ctx context.Context, key string) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	_, err := c.GetContext(context.Background(), "key", load)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// context errors aren't negatively cached.
+	v, err := c.GetContext(context.Background(), "key", func(context.Context, string) (int, error) {
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestTypedLoadingCache_GetContext_LoadPanic(t *testing.T) {
+	c := NewTypedLoadingCache[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = c.GetContext(ctx, "key", func(context.Context, string) (int, error) { panic("boom") })
+	})
+	assert.Equal(t, 0, c.Len())
+}
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/antchfx/xpath"
 	"github.com/stretchr/testify/assert"
@@ -115,7 +116,7 @@ func TestLoadingCache_Get(t *testing.T) {
 			// Populate the cache with initial key/value pairs.
 			initKVs := []string{"1", "one", "2", "two"}
 			for i := 0; i < len(initKVs)/2; i++ {
-				test.cache.cache.Add(initKVs[i*2], initKVs[i*2+1])
+				test.cache.Put(initKVs[i*2], initKVs[i*2+1])
 			}
 			val, err := test.cache.Get(test.key, test.load)
 			if test.expectedError != nil {
@@ -170,3 +171,13 @@ func BenchmarkLoadingCache_LargeCapacityLimit(b *testing.B) {
 		assert.NoError(b, err)
 	}
 }
+
+func TestNewLoadingCacheEx(t *testing.T) {
+	clock := newMockClock()
+	c := NewLoadingCacheEx(LoadingCacheOptions{ExpireAfterWrite: time.Second, Clock: clock})
+	v, err := c.Get("key", func(key interface{}) (interface{}, error) { return "val", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "val", v.(string))
+	clock.Advance(time.Second)
+	assert.Equal(t, map[interface{}]interface{}{}, c.DumpForTest())
+}
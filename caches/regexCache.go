@@ -1,20 +1,30 @@
 package caches
 
 import (
+	"bytes"
 	"regexp"
+	"regexp/syntax"
+	"strings"
 )
 
 // RegexCache is the default loading cache used for caching the compiled
-// regex expression. If the default size is too big/small and/or a cache limit isn't
-// desired at all, caller can simply replace the cache during global initialization.
-// But be aware it's global so any packages uses this package inside your process will
-// be affected.
+// regex expression, i.e. the RegexCacheName cache of DefaultCacheRegistry. Be aware it's
+// global so any packages uses this package inside your process will be affected by replacing
+// it; to customize the cache for your own use, create a CacheRegistry instead. For highly
+// concurrent workloads, a sharded cache created by NewShardedLoadingCache can be used to
+// reduce lock contention.
 var RegexCache = NewLoadingCache()
 
 // GetRegex compiles a given regex pattern and returns a compiled *regexp.Regexp
-// or error.
+// or error, using DefaultCacheRegistry.
 func GetRegex(pattern string) (*regexp.Regexp, error) {
-	exp, err := RegexCache.Get(pattern, func(key interface{}) (interface{}, error) {
+	return defaultCacheRegistry.GetRegex(pattern)
+}
+
+// GetRegex compiles a given regex pattern and returns a compiled *regexp.Regexp
+// or error, using the registry's RegexCacheName cache.
+func (r *CacheRegistry) GetRegex(pattern string) (*regexp.Regexp, error) {
+	exp, err := r.Cache(RegexCacheName).Get(pattern, func(key interface{}) (interface{}, error) {
 		return regexp.Compile(key.(string))
 	})
 	if err != nil {
@@ -22,3 +32,146 @@ func GetRegex(pattern string) (*regexp.Regexp, error) {
 	}
 	return exp.(*regexp.Regexp), nil
 }
+
+// Matcher is the common interface of the matchers returned by GetRegexWithOptions. It's a subset
+// of the methods of *regexp.Regexp, with the same semantics.
+type Matcher interface {
+	Match(b []byte) bool
+	MatchString(s string) bool
+	FindString(s string) string
+	FindStringIndex(s string) []int
+	FindAllString(s string, n int) []string
+	FindAllStringIndex(s string, n int) [][]int
+	// String returns the source text used to compile the Matcher.
+	String() string
+}
+
+// RegexOptions tells GetRegexWithOptions how to compile a regex pattern.
+type RegexOptions struct {
+	// POSIX compiles the pattern with regexp.CompilePOSIX, i.e. restricted to POSIX ERE syntax
+	// and with leftmost-longest matching.
+	POSIX bool
+	// CaseInsensitive makes the matching case-insensitive, as if the pattern is prefixed with (?i).
+	CaseInsensitive bool
+	// Literal enables the literal fast-path: a pattern free of regex metacharacters is matched
+	// by strings.Index, instead of by the regex engine.
+	Literal bool
+}
+
+// regexKey is the key of the patterns compiled with options in the regex cache, so that they
+// don't collide with the patterns compiled by GetRegex, or with different options.
+type regexKey struct {
+	pattern string
+	opts    RegexOptions
+}
+
+// GetRegexWithOptions compiles a given regex pattern with the given options and returns a
+// compiled Matcher or error, using DefaultCacheRegistry. The returned Matcher is a *regexp.Regexp,
+// unless the literal fast-path is taken.
+func GetRegexWithOptions(pattern string, opts RegexOptions) (Matcher, error) {
+	return defaultCacheRegistry.GetRegexWithOptions(pattern, opts)
+}
+
+// GetRegexWithOptions compiles a given regex pattern with the given options and returns a
+// compiled Matcher or error, using the registry's RegexCacheName cache.
+func (r *CacheRegistry) GetRegexWithOptions(pattern string, opts RegexOptions) (Matcher, error) {
+	m, err := r.Cache(RegexCacheName).Get(regexKey{pattern: pattern, opts: opts},
+		func(key interface{}) (interface{}, error) {
+			return compileMatcher(key.(regexKey))
+		})
+	if err != nil {
+		return nil, err
+	}
+	return m.(Matcher), nil
+}
+
+func compileMatcher(key regexKey) (Matcher, error) {
+	// an empty pattern matches between every rune, which isn't worth a fast-path. And a literal
+	// with letters can't be matched case-insensitively by strings.Index.
+	if key.opts.Literal && key.pattern != "" && regexp.QuoteMeta(key.pattern) == key.pattern &&
+		(!key.opts.CaseInsensitive || strings.ToLower(key.pattern) == strings.ToUpper(key.pattern)) {
+		return newLiteralMatcher(key.pattern), nil
+	}
+	if !key.opts.CaseInsensitive {
+		if key.opts.POSIX {
+			return regexp.CompilePOSIX(key.pattern)
+		}
+		return regexp.Compile(key.pattern)
+	}
+	if key.opts.POSIX {
+		// POSIX syntax has no flags, so parse the pattern as POSIX with case folding, then compile
+		// the parsed regex back in the (superset) Perl syntax, with leftmost-longest matching. The
+		// parsed regex spells out the POSIX semantics explicitly (e.g. '^' matching at line starts,
+		// '[^a]' not matching '\n'), so they're kept by the Perl syntax compilation.
+		re, err := syntax.Parse(key.pattern, syntax.POSIX|syntax.FoldCase)
+		if err != nil {
+			return nil, err
+		}
+		exp, err := regexp.Compile(re.String())
+		if err != nil {
+			return nil, err
+		}
+		exp.Longest()
+		return exp, nil
+	}
+	return regexp.Compile("(?i)" + key.pattern)
+}
+
+// literalMatcher is a Matcher of a non-empty metacharacter-free pattern. Both leftmost-first and
+// leftmost-longest semantics are the same for a literal. The literal is kept as both string and []byte,
+// so that no matching method converts its input.
+type literalMatcher struct {
+	s string
+	b []byte
+}
+
+func newLiteralMatcher(literal string) *literalMatcher {
+	return &literalMatcher{s: literal, b: []byte(literal)}
+}
+
+func (m *literalMatcher) Match(b []byte) bool {
+	return bytes.Contains(b, m.b)
+}
+
+func (m *literalMatcher) MatchString(s string) bool {
+	return strings.Contains(s, m.s)
+}
+
+func (m *literalMatcher) FindString(s string) string {
+	if strings.Contains(s, m.s) {
+		return m.s
+	}
+	return ""
+}
+
+func (m *literalMatcher) FindStringIndex(s string) []int {
+	if i := strings.Index(s, m.s); i >= 0 {
+		return []int{i, i + len(m.s)}
+	}
+	return nil
+}
+
+func (m *literalMatcher) FindAllString(s string, n int) []string {
+	var matches []string
+	for _, loc := range m.FindAllStringIndex(s, n) {
+		matches = append(matches, s[loc[0]:loc[1]])
+	}
+	return matches
+}
+
+func (m *literalMatcher) FindAllStringIndex(s string, n int) [][]int {
+	var locs [][]int
+	for start := 0; n < 0 || len(locs) < n; {
+		i := strings.Index(s[start:], m.s)
+		if i < 0 {
+			break
+		}
+		locs = append(locs, []int{start + i, start + i + len(m.s)})
+		start += i + len(m.s)
+	}
+	return locs
+}
+
+func (m *literalMatcher) String() string {
+	return m.s
+}
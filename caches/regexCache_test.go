@@ -1,6 +1,8 @@
 package caches
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,3 +28,223 @@ func TestGetRegex(t *testing.T) {
 	assert.NotNil(t, expr)
 	assert.Equal(t, 1, len(RegexCache.DumpForTest()))
 }
+
+func TestCacheRegistry_GetRegex(t *testing.T) {
+	RegexCache = NewLoadingCache()
+	r := NewCacheRegistry()
+	expr, err := r.GetRegex("^a+$")
+	assert.NoError(t, err)
+	assert.True(t, expr.MatchString("aaa"))
+	_, err = r.GetRegex("[")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(r.Cache(RegexCacheName).DumpForTest()))
+	// the registry is isolated from the default one.
+	assert.Equal(t, 0, len(RegexCache.DumpForTest()))
+}
+
+func TestGetRegexWithOptions(t *testing.T) {
+	RegexCache = NewLoadingCache()
+	for _, test := range []struct {
+		name            string
+		pattern         string
+		opts            RegexOptions
+		expectedLiteral bool
+		expectedErr     string
+		input           string
+		expectedMatches []string
+	}{
+		{
+			name:            "literal fast-path",
+			pattern:         "ab",
+			opts:            RegexOptions{Literal: true},
+			expectedLiteral: true,
+			input:           "xabyababz",
+			expectedMatches: []string{"ab", "ab", "ab"},
+		},
+		{
+			name:            "literal fast-path case-insensitive without letters",
+			pattern:         "1-2",
+			opts:            RegexOptions{Literal: true, CaseInsensitive: true},
+			expectedLiteral: true,
+			input:           "1-21-2",
+			expectedMatches: []string{"1-2", "1-2"},
+		},
+		{
+			name:            "literal with letters case-insensitive goes to regex",
+			pattern:         "ab",
+			opts:            RegexOptions{Literal: true, CaseInsensitive: true},
+			input:           "xAbyaB",
+			expectedMatches: []string{"Ab", "aB"},
+		},
+		{
+			name:            "literal not enabled",
+			pattern:         "ab",
+			input:           "ab",
+			expectedMatches: []string{"ab"},
+		},
+		{
+			name:            "metacharacters go to regex",
+			pattern:         "a.c",
+			opts:            RegexOptions{Literal: true},
+			input:           "abc a.c",
+			expectedMatches: []string{"abc", "a.c"},
+		},
+		{
+			name:            "empty pattern goes to regex",
+			pattern:         "",
+			opts:            RegexOptions{Literal: true},
+			input:           "ab",
+			expectedMatches: []string{"", "", ""},
+		},
+		{
+			name:            "leftmost-first",
+			pattern:         "a|ab",
+			input:           "ab",
+			expectedMatches: []string{"a"},
+		},
+		{
+			name:            "POSIX leftmost-longest",
+			pattern:         "a|ab",
+			opts:            RegexOptions{POSIX: true},
+			input:           "ab",
+			expectedMatches: []string{"ab"},
+		},
+		{
+			name:            "POSIX case-insensitive",
+			pattern:         "a|ab",
+			opts:            RegexOptions{POSIX: true, CaseInsensitive: true},
+			input:           "AB",
+			expectedMatches: []string{"AB"},
+		},
+		{
+			name:            "POSIX case-insensitive keeps POSIX semantics",
+			pattern:         "^abc|[^x]",
+			opts:            RegexOptions{POSIX: true, CaseInsensitive: true},
+			input:           "x\nABC",
+			expectedMatches: []string{"ABC"},
+		},
+		{
+			name:        "POSIX case-insensitive non POSIX syntax",
+			pattern:     `\d`,
+			opts:        RegexOptions{POSIX: true, CaseInsensitive: true},
+			expectedErr: "error parsing regexp: invalid escape sequence: `\\d`",
+		},
+		{
+			name:        "invalid pattern",
+			pattern:     "[",
+			opts:        RegexOptions{Literal: true},
+			expectedErr: "error parsing regexp: missing closing ]: `[`",
+		},
+		{
+			name:        "non POSIX syntax",
+			pattern:     `\d`,
+			opts:        RegexOptions{POSIX: true},
+			expectedErr: "error parsing regexp: invalid escape sequence: `\\d`",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := GetRegexWithOptions(test.pattern, test.opts)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			_, isLiteral := m.(*literalMatcher)
+			assert.Equal(t, test.expectedLiteral, isLiteral)
+			assert.Equal(t, test.expectedMatches, m.FindAllString(test.input, -1))
+			m2, err := GetRegexWithOptions(test.pattern, test.opts)
+			assert.NoError(t, err)
+			assert.True(t, m == m2)
+		})
+	}
+	// case-insensitive POSIX matching is the same as POSIX matching, on a multi-line input.
+	for _, pattern := range []string{"^abc", "abc$", "[^a]", "[^a]+", "^.*$", "a.c", "[[:space:]]"} {
+		posix, err := GetRegexWithOptions(pattern, RegexOptions{POSIX: true})
+		assert.NoError(t, err)
+		posixCI, err := GetRegexWithOptions(pattern, RegexOptions{POSIX: true, CaseInsensitive: true})
+		assert.NoError(t, err)
+		for _, input := range []string{"x\nabc", "abc\nx", "\n", "a\nc", "b\na\n"} {
+			assert.Equal(t, posix.MatchString(input), posixCI.MatchString(input), "%s: %q", pattern, input)
+			assert.Equal(t, posix.FindAllStringIndex(input, -1), posixCI.FindAllStringIndex(input, -1),
+				"%s: %q", pattern, input)
+		}
+	}
+	// patterns compiled with options don't collide with the ones compiled by GetRegex.
+	r, err := GetRegex("ab")
+	assert.NoError(t, err)
+	m, err := GetRegexWithOptions("ab", RegexOptions{})
+	assert.NoError(t, err)
+	assert.False(t, Matcher(r) == m)
+}
+
+func TestLiteralMatcher(t *testing.T) {
+	for _, test := range []struct {
+		literal string
+		input   string
+	}{
+		{literal: "ab", input: ""},
+		{literal: "ab", input: "ab"},
+		{literal: "ab", input: "xxabxxab"},
+		{literal: "aa", input: "aaaaa"},
+		{literal: "ab", input: "ba"},
+		{literal: "日本", input: "日本語日本"},
+	} {
+		t.Run(test.literal+"/"+test.input, func(t *testing.T) {
+			// a literalMatcher must behave exactly the same as the regex.
+			m := newLiteralMatcher(test.literal)
+			exp := regexp.MustCompile(regexp.QuoteMeta(test.literal))
+			assert.Equal(t, exp.Match([]byte(test.input)), m.Match([]byte(test.input)))
+			assert.Equal(t, exp.MatchString(test.input), m.MatchString(test.input))
+			assert.Equal(t, exp.FindString(test.input), m.FindString(test.input))
+			assert.Equal(t, exp.FindStringIndex(test.input), m.FindStringIndex(test.input))
+			for _, n := range []int{-1, 0, 1, 2} {
+				assert.Equal(t, exp.FindAllString(test.input, n), m.FindAllString(test.input, n))
+				assert.Equal(t, exp.FindAllStringIndex(test.input, n), m.FindAllStringIndex(test.input, n))
+			}
+			assert.Equal(t, exp.String(), m.String())
+		})
+	}
+	// matching doesn't convert the input.
+	m := newLiteralMatcher("needle")
+	input := []byte(strings.Repeat("haystack ", 200) + "needle")
+	assert.Equal(t, float64(0), testing.AllocsPerRun(10, func() { m.Match(input) }))
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	input := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20) + "needle"
+	for _, bm := range []struct {
+		name string
+		opts RegexOptions
+	}{
+		{name: "regex", opts: RegexOptions{}},
+		{name: "literal", opts: RegexOptions{Literal: true}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			m, err := GetRegexWithOptions("needle", bm.opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !m.MatchString(input) {
+					b.Fatal("no match")
+				}
+			}
+		})
+		b.Run(bm.name+"/bytes", func(b *testing.B) {
+			m, err := GetRegexWithOptions("needle", bm.opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			inputBytes := []byte(input)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !m.Match(inputBytes) {
+					b.Fatal("no match")
+				}
+			}
+		})
+	}
+}
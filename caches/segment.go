@@ -0,0 +1,427 @@
+package caches
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// segment is an independently locked partition of a TypedLoadingCache. It holds all the values, cached
+// errors and in-flight loads of the keys hashed into it, and enforces its share of the cache limits.
+type segment[K comparable, V any] struct {
+	mu                sync.Mutex
+	clock             Clock
+	expireAfterWrite  time.Duration
+	expireAfterAccess time.Duration
+	refreshAfterWrite time.Duration
+	loadTimeout       time.Duration
+	cacheErrors       bool
+	errExpireAfter    time.Duration
+	errMaxHits        int
+	values            *store[K, V]
+	errs              *store[K, error] // negatively cached load errors, see ErrorExpireAfterWrite.
+	calls             map[K]*call[V]   // in-flight loads, keyed by the key being loaded.
+	onEviction        func(key K, val V, reason EvictionReason)
+	disk              *diskStore[K, V]     // optional on-disk second level, shared by all the segments.
+	evicted           []evictedEntry[K, V] // evictions pending to be reported to onEviction.
+	stats             LoadingCacheStats
+	// invalidations is bumped, with mu held, upon each explicit removal (and Put), before the key is
+	// removed from disk. A value evicted to disk before the bump (and written to disk after it, as the
+	// disk write happens outside of mu) must not be written, lest it outlive the removal.
+	invalidations atomic.Int64
+	// timed tells any of the durations is set; if not, lookups skip reading the clock.
+	timed bool
+}
+
+type evictedEntry[K comparable, V any] struct {
+	key       K
+	val       V
+	writeTime time.Time
+	reason    EvictionReason
+	// invalidations is segment.invalidations at the time of the eviction.
+	invalidations int64
+}
+
+// call is an in-flight (or completed) load shared by all the concurrent Get callers of the same key.
+type call[V any] struct {
+	done     chan struct{} // closed once the load is completed.
+	val      V
+	err      error
+	panicked bool
+	panicVal interface{}
+	discard  bool // the key was invalidated or Put while loading, so the outcome mustn't be cached.
+	refresh  bool // the call is a background refresh.
+	// fromDisk tells the value was taken from the on-disk second level, instead of loaded, in which case
+	// writeTime is the time the value was originally loaded.
+	fromDisk  bool
+	writeTime time.Time
+}
+
+func newCall[V any]() *call[V] {
+	return &call[V]{done: make(chan struct{})}
+}
+
+func (cl *call[V]) result() (V, error) {
+	if cl.panicked {
+		panic(cl.panicVal)
+	}
+	return cl.val, cl.err
+}
+
+// newSegment creates a segment with the given (already validated) options, bound by the given share
+// of the cache limits.
+func newSegment[K comparable, V any](
+	opts TypedLoadingCacheOptions[K, V], clock Clock, hasher func(K) uint64,
+	capacity, errCapacity int, maxWeight int64) *segment[K, V] {
+	s := &segment[K, V]{
+		clock:             clock,
+		expireAfterWrite:  opts.ExpireAfterWrite,
+		expireAfterAccess: opts.ExpireAfterAccess,
+		refreshAfterWrite: opts.RefreshAfterWrite,
+		loadTimeout:       opts.LoadTimeout,
+		cacheErrors:       opts.ErrorExpireAfterWrite > 0 || opts.ErrorMaxHits > 0,
+		errExpireAfter:    opts.ErrorExpireAfterWrite,
+		errMaxHits:        opts.ErrorMaxHits,
+		values:            newStore[K, V](capacity, newPolicy[K, V](opts.EvictionPolicy, capacity, hasher)),
+		errs:              newStore[K, error](errCapacity, newLRUPolicy[K, error]()),
+		calls:             make(map[K]*call[V]),
+		onEviction:        opts.OnEviction,
+	}
+	s.values.weigher, s.values.maxWeight = opts.Weigher, maxWeight
+	s.timed = s.expireAfterWrite > 0 || s.expireAfterAccess > 0 || s.refreshAfterWrite > 0 || s.errExpireAfter > 0
+	s.values.onEvict = func(e *entry[K, V]) {
+		s.evictedLocked(e, EvictionReasonCapacity)
+	}
+	return s
+}
+
+// get is TypedLoadingCache.Get confined to the segment.
+func (s *segment[K, V]) get(key K, l loader[K, V]) (V, error) {
+	v, err, cl, owner := s.lookup(key, l)
+	if cl == nil {
+		return v, err
+	}
+	if owner {
+		s.doLoad(key, l, cl)
+	} else {
+		<-cl.done
+	}
+	return cl.result()
+}
+
+// lookup returns the cached value or error of the key if there is one. Otherwise it returns the
+// in-flight call of the key: if the call is newly created (owner == true), the caller must carry out
+// the load and complete the call, else the caller only needs to wait for it.
+func (s *segment[K, V]) lookup(key K, l loader[K, V]) (v V, err error, cl *call[V], owner bool) {
+	s.mu.Lock()
+	var now time.Time
+	if s.timed {
+		now = s.clock.Now()
+	}
+	if e, found := s.values.get(key); found {
+		if !s.expired(e, now) {
+			s.stats.Hits++
+			if s.expireAfterAccess > 0 {
+				e.accessTime = now
+			}
+			s.values.touch(e)
+			v = e.val
+			if s.needsRefresh(e, now) {
+				s.refreshLocked(key, l)
+			}
+			s.mu.Unlock()
+			return v, nil, nil, false
+		}
+		s.values.remove(e)
+		s.evictedLocked(e, EvictionReasonExpired)
+	}
+	if err, found := s.getErrorLocked(key, now); found {
+		s.stats.ErrorHits++
+		s.unlock()
+		return v, err, nil, false
+	}
+	s.stats.Misses++
+	if cl, found := s.calls[key]; found {
+		s.unlock()
+		return v, nil, cl, false
+	}
+	cl = newCall[V]()
+	s.calls[key] = cl
+	s.unlock()
+	return v, nil, cl, true
+}
+
+func (s *segment[K, V]) expired(e *entry[K, V], now time.Time) bool {
+	return (s.expireAfterWrite > 0 && now.Sub(e.writeTime) >= s.expireAfterWrite) ||
+		(s.expireAfterAccess > 0 && now.Sub(e.accessTime) >= s.expireAfterAccess)
+}
+
+// getErrorLocked returns the negatively cached load error of the key, if any. Must be called with
+// s.mu held.
+func (s *segment[K, V]) getErrorLocked(key K, now time.Time) (error, bool) {
+	e, found := s.errs.get(key)
+	if !found {
+		return nil, false
+	}
+	if (s.errExpireAfter > 0 && now.Sub(e.writeTime) >= s.errExpireAfter) ||
+		(s.errMaxHits > 0 && e.hits >= s.errMaxHits) {
+		s.errs.remove(e)
+		return nil, false
+	}
+	e.hits++
+	s.errs.touch(e)
+	return e.val, true
+}
+
+func (s *segment[K, V]) needsRefresh(e *entry[K, V], now time.Time) bool {
+	return s.refreshAfterWrite > 0 && now.Sub(e.writeTime) >= s.refreshAfterWrite
+}
+
+// refreshLocked kicks off a background reload of the key, unless there is already a load in flight
+// for it. Must be called with s.mu held.
+func (s *segment[K, V]) refreshLocked(key K, l loader[K, V]) {
+	if _, found := s.calls[key]; found {
+		return
+	}
+	cl := newCall[V]()
+	cl.refresh = true
+	s.calls[key] = cl
+	// Any panic from the load function is captured by doLoad and only re-raised in callers that
+	// end up waiting on this call, so it won't crash the process from the background goroutine.
+	go s.doLoad(key, l, cl)
+}
+
+var errLoadGoexit = errors.New("load function called runtime.Goexit")
+
+func (s *segment[K, V]) doLoad(key K, l loader[K, V], cl *call[V]) {
+	normalReturn := false
+	start := s.clock.Now()
+	defer func() {
+		if !normalReturn {
+			recordAbnormalReturn(cl, recover())
+		}
+		s.complete(key, cl, normalReturn, s.clock.Now().Sub(start))
+	}()
+	if !s.takeFromDisk(key, cl) {
+		cl.val, cl.err = l.call(key, s.loadTimeout)
+	}
+	normalReturn = true
+}
+
+// recordAbnormalReturn records into the call the panic value recovered from a load function that
+// didn't return normally.
+func recordAbnormalReturn[V any](cl *call[V], r interface{}) {
+	if r != nil {
+		cl.panicked, cl.panicVal = true, r
+	} else {
+		// recover() returns nil only if the load function called runtime.Goexit (or, pre go1.21,
+		// panic(nil)); either way, the waiters must not be left hanging.
+		cl.err = errLoadGoexit
+	}
+}
+
+// takeFromDisk moves the unexpired value of the key, if any, from the on-disk second level into the
+// call. A background refresh always calls the load function instead.
+func (s *segment[K, V]) takeFromDisk(key K, cl *call[V]) bool {
+	if s.disk == nil || cl.refresh {
+		return false
+	}
+	v, writeTime, found := s.disk.take(key)
+	if !found || (s.expireAfterWrite > 0 && s.clock.Now().Sub(writeTime) >= s.expireAfterWrite) {
+		return false
+	}
+	cl.val, cl.writeTime, cl.fromDisk = v, writeTime, true
+	return true
+}
+
+// complete caches the outcome of the finished load of the call (unless the call is discarded), and
+// releases the waiters of the call.
+func (s *segment[K, V]) complete(key K, cl *call[V], normalReturn bool, loadTime time.Duration) {
+	s.mu.Lock()
+	delete(s.calls, key)
+	if !cl.fromDisk {
+		s.stats.TotalLoadTime += loadTime
+	}
+	if normalReturn && cl.err == nil {
+		if !cl.fromDisk {
+			s.stats.LoadSuccesses++
+		}
+		if !cl.discard {
+			s.addLocked(key, cl.val)
+			if e, found := s.values.get(key); found && cl.fromDisk {
+				e.writeTime = cl.writeTime
+			}
+		}
+	} else {
+		s.stats.LoadFailures++
+		if normalReturn && s.cacheErrors && !cl.discard && !isContextErr(cl.err) {
+			s.errs.add(key, cl.err, s.clock.Now())
+		}
+	}
+	evicted := s.takeEvictedLocked()
+	s.mu.Unlock()
+	// Release the waiters before reporting evictions so a misbehaving OnEviction can't hang them.
+	close(cl.done)
+	s.notifyEvicted(evicted)
+}
+
+func (s *segment[K, V]) put(key K, val V) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.invalidatedLocked()
+	if cl, found := s.calls[key]; found {
+		cl.discard = true
+	}
+	s.addLocked(key, val)
+}
+
+// peek returns the unexpired value of the key, if any, without affecting the entry or the stats.
+func (s *segment[K, V]) peek(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, found := s.values.get(key); found && !s.expired(e, s.clock.Now()) {
+		return e.val, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (s *segment[K, V]) invalidate(key K) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.invalidatedLocked()
+	if e, found := s.values.get(key); found {
+		s.values.remove(e)
+		s.evictedLocked(e, EvictionReasonExplicit)
+	}
+	if e, found := s.errs.get(key); found {
+		s.errs.remove(e)
+	}
+	if cl, found := s.calls[key]; found {
+		cl.discard = true
+	}
+}
+
+func (s *segment[K, V]) invalidateAll() {
+	s.mu.Lock()
+	defer s.unlock()
+	s.invalidatedLocked()
+	for _, e := range s.values.entries {
+		s.values.remove(e)
+		s.evictedLocked(e, EvictionReasonExplicit)
+	}
+	for _, e := range s.errs.entries {
+		s.errs.remove(e)
+	}
+	for _, cl := range s.calls {
+		cl.discard = true
+	}
+}
+
+func (s *segment[K, V]) invalidateIf(pred func(key K, val V) bool) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.invalidatedLocked()
+	for _, e := range s.values.entries {
+		if pred(e.key, e.val) {
+			s.values.remove(e)
+			s.evictedLocked(e, EvictionReasonExplicit)
+		}
+	}
+}
+
+func (s *segment[K, V]) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values.len()
+}
+
+func (s *segment[K, V]) addLocked(key K, val V) {
+	if e, found := s.errs.get(key); found {
+		s.errs.remove(e)
+	}
+	s.values.add(key, val, s.clock.Now())
+}
+
+// evictedLocked records a value removal to be reported to OnEviction once s.mu is released. Must be
+// called with s.mu held.
+func (s *segment[K, V]) evictedLocked(e *entry[K, V], reason EvictionReason) {
+	if reason != EvictionReasonExplicit {
+		s.stats.Evictions++
+	}
+	if s.onEviction != nil || (s.disk != nil && reason == EvictionReasonCapacity) {
+		s.evicted = append(s.evicted, evictedEntry[K, V]{
+			key: e.key, val: e.val, writeTime: e.writeTime, reason: reason,
+			invalidations: s.invalidations.Load(),
+		})
+	}
+}
+
+func (s *segment[K, V]) takeEvictedLocked() []evictedEntry[K, V] {
+	evicted := s.evicted
+	s.evicted = nil
+	return evicted
+}
+
+// notifyEvicted moves the values evicted due to capacity to the on-disk second level, if any, and
+// reports all the evictions to OnEviction, if any.
+func (s *segment[K, V]) notifyEvicted(evicted []evictedEntry[K, V]) {
+	for _, e := range evicted {
+		if s.disk != nil && e.reason == EvictionReasonCapacity {
+			s.putToDisk(e)
+		}
+		if s.onEviction != nil {
+			s.onEviction(e.key, e.val, e.reason)
+		}
+	}
+}
+
+// putToDisk writes an evicted (or snapshotted) entry to disk, unless the segment has had an explicit
+// removal since.
+func (s *segment[K, V]) putToDisk(e evictedEntry[K, V]) {
+	s.disk.putIf(e.key, e.val, e.writeTime, func() bool {
+		return s.invalidations.Load() == e.invalidations
+	})
+}
+
+// invalidatedLocked records an explicit removal. Must be called with s.mu held.
+func (s *segment[K, V]) invalidatedLocked() {
+	s.invalidations.Add(1)
+}
+
+// snapshot returns all the unexpired entries of the segment.
+func (s *segment[K, V]) snapshot() []evictedEntry[K, V] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	invalidations := s.invalidations.Load()
+	entries := make([]evictedEntry[K, V], 0, s.values.len())
+	for _, e := range s.values.entries {
+		if !s.expired(e, now) {
+			entries = append(entries, evictedEntry[K, V]{
+				key: e.key, val: e.val, writeTime: e.writeTime, invalidations: invalidations,
+			})
+		}
+	}
+	return entries
+}
+
+// unlock releases s.mu and then reports the pending evictions, if any, to OnEviction.
+func (s *segment[K, V]) unlock() {
+	evicted := s.takeEvictedLocked()
+	s.mu.Unlock()
+	s.notifyEvicted(evicted)
+}
+
+// dump copies all the unexpired values of the segment into m.
+func (s *segment[K, V]) dump(m map[K]V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	for k, e := range s.values.entries {
+		if !s.expired(e, now) {
+			m[k] = e.val
+		}
+	}
+}
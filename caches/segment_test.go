@@ -0,0 +1,68 @@
+package caches
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSegment(t *testing.T) {
+	s := newSegment(TypedLoadingCacheOptions[string, int]{
+		Weigher:               func(key string, val int) int { return val },
+		ErrorExpireAfterWrite: time.Second,
+	}, osClock{}, defaultHasher[string], 10, 5, 100)
+	assert.Equal(t, 10, s.values.capacity)
+	assert.Equal(t, int64(100), s.values.maxWeight)
+	assert.NotNil(t, s.values.weigher)
+	assert.NotNil(t, s.values.onEvict)
+	assert.Equal(t, 5, s.errs.capacity)
+	assert.True(t, s.cacheErrors)
+}
+
+func TestSegment_DoLoad_Goexit(t *testing.T) {
+	s := newSegment(TypedLoadingCacheOptions[string, int]{}, osClock{}, defaultHasher[string], 10, 10, 0)
+	cl := newCall[int]()
+	s.calls["key"] = cl
+	go s.doLoad("key", loader[string, int]{load: func(key string) (int, error) {
+		runtime.Goexit()
+		return 0, nil
+	}}, cl)
+	<-cl.done
+	v, err := cl.result()
+	assert.Equal(t, errLoadGoexit, err)
+	assert.Equal(t, 0, v)
+	assert.Equal(t, 0, s.values.len())
+	assert.Equal(t, 0, len(s.calls))
+}
+
+func TestSegment_Lookup_ClockReads(t *testing.T) {
+	type opts = TypedLoadingCacheOptions[string, int]
+	for _, test := range []struct {
+		name          string
+		opts          opts
+		expectedReads int
+	}{
+		{name: "no durations", opts: opts{}, expectedReads: 0},
+		{name: "expire after write", opts: opts{ExpireAfterWrite: time.Hour}, expectedReads: 1},
+		{name: "expire after access", opts: opts{ExpireAfterAccess: time.Hour}, expectedReads: 1},
+		{name: "refresh after write", opts: opts{RefreshAfterWrite: time.Hour}, expectedReads: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newMockClock()
+			s := newSegment(test.opts, clock, defaultHasher[string], 10, 10, 0)
+			s.values.add("a", 1, clock.Now())
+			clock.Advance(time.Minute)
+			reads := clock.reads
+			v, err, cl, _ := s.lookup("a", loader[string, int]{})
+			assert.NoError(t, err)
+			assert.Nil(t, cl)
+			assert.Equal(t, 1, v)
+			// a hit reads the clock only if any duration is set.
+			assert.Equal(t, test.expectedReads, clock.reads-reads)
+			e, _ := s.values.get("a")
+			assert.Equal(t, test.opts.ExpireAfterAccess > 0, e.accessTime.Equal(clock.Now()))
+		})
+	}
+}
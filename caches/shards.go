@@ -0,0 +1,63 @@
+package caches
+
+import (
+	"fmt"
+	"hash/maphash"
+)
+
+var hashSeed = maphash.MakeSeed()
+
+func hashString(s string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(hashSeed)
+	_, _ = h.WriteString(s)
+	return h.Sum64()
+}
+
+// mixUint64 is the finalizer of splitmix64, which spreads the bits of sequential integer keys so that
+// they don't end up in the same few shards.
+func mixUint64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// defaultHasher is the Hasher used by a sharded TypedLoadingCache if none is specified.
+func defaultHasher[K comparable](key K) uint64 {
+	switch k := interface{}(key).(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return mixUint64(uint64(k))
+	case int8:
+		return mixUint64(uint64(k))
+	case int16:
+		return mixUint64(uint64(k))
+	case int32:
+		return mixUint64(uint64(k))
+	case int64:
+		return mixUint64(uint64(k))
+	case uint:
+		return mixUint64(uint64(k))
+	case uint8:
+		return mixUint64(uint64(k))
+	case uint16:
+		return mixUint64(uint64(k))
+	case uint32:
+		return mixUint64(uint64(k))
+	case uint64:
+		return mixUint64(k)
+	case uintptr:
+		return mixUint64(uint64(k))
+	case bool:
+		if k {
+			return 1
+		}
+		return 0
+	default:
+		return hashString(fmt.Sprintf("%#v", key))
+	}
+}
@@ -0,0 +1,173 @@
+package caches
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/testlib"
+)
+
+func TestDefaultHasher(t *testing.T) {
+	// same key, same hash.
+	assert.Equal(t, defaultHasher("abc"), defaultHasher("abc"))
+	assert.Equal(t, defaultHasher[interface{}]("abc"), defaultHasher("abc"))
+	assert.NotEqual(t, defaultHasher("abc"), defaultHasher("abd"))
+	assert.Equal(t, defaultHasher(int64(5)), defaultHasher(5))
+	assert.NotEqual(t, defaultHasher(5), defaultHasher(6))
+	assert.Equal(t, uint64(1), defaultHasher(true))
+	assert.Equal(t, uint64(0), defaultHasher(false))
+	type point struct{ x, y int }
+	assert.Equal(t, defaultHasher(point{1, 2}), defaultHasher(point{1, 2}))
+	assert.NotEqual(t, defaultHasher(point{1, 2}), defaultHasher(point{2, 1}))
+	for _, k := range []interface{}{
+		int8(1), int16(1), int32(1), uint(1), uint8(1), uint16(1), uint32(1), uint64(1), uintptr(1),
+	} {
+		assert.Equal(t, defaultHasher(1), defaultHasher(k), "%T", k)
+	}
+}
+
+func TestDefaultHasher_Distribution(t *testing.T) {
+	const shards = 16
+	const keys = 16000
+	for _, name := range []string{"string", "int"} {
+		t.Run(name, func(t *testing.T) {
+			counts := make([]int, shards)
+			for i := 0; i < keys; i++ {
+				var h uint64
+				if name == "string" {
+					h = defaultHasher("key-" + strconv.Itoa(i))
+				} else {
+					h = defaultHasher(i)
+				}
+				counts[h%shards]++
+			}
+			for i, count := range counts {
+				// each shard should get roughly keys/shards = 1000 keys.
+				assert.True(t, count > 800 && count < 1200, "shard %d got %d keys", i, count)
+			}
+		})
+	}
+}
+
+func TestShareOf(t *testing.T) {
+	assert.Equal(t, 10, shareOf(10, 1))
+	assert.Equal(t, 4, shareOf(10, 3))
+	assert.Equal(t, 1, shareOf(1, 16))
+	assert.Equal(t, resolveCapacity(0), shareOf(resolveCapacity(0), 16))
+}
+
+func TestShardedLoadingCache(t *testing.T) {
+	assert.PanicsWithError(t, "Shards must be >= 0, instead got: -1", func() {
+		NewShardedLoadingCache(-1)
+	})
+
+	c := NewShardedLoadingCache(4, 100)
+	assert.Equal(t, 100, c.capacity)
+	assert.Equal(t, 4, len(c.segments))
+	for _, s := range c.segments {
+		assert.Equal(t, 25, s.values.capacity)
+	}
+
+	loads := 0
+	for i := 0; i < 40; i++ {
+		v, err := c.Get(strconv.Itoa(i), func(key interface{}) (interface{}, error) {
+			loads++
+			return strconv.Atoi(key.(string))
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, i, v)
+	}
+	for i := 0; i < 40; i++ {
+		v, err := c.Get(strconv.Itoa(i), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, i, v)
+	}
+	assert.Equal(t, 40, loads)
+	assert.Equal(t, 40, len(c.DumpForTest()))
+	s := c.Stats()
+	assert.Equal(t, int64(40), s.Hits)
+	assert.Equal(t, int64(40), s.Misses)
+	assert.Equal(t, 40, s.Size)
+	// keys are spread across the shards.
+	for _, seg := range c.segments {
+		assert.True(t, seg.values.len() > 0)
+	}
+}
+
+func TestShardedTypedLoadingCache_CustomHasher(t *testing.T) {
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[int, int]{
+		Capacity: testlib.IntPtr(8),
+		Shards:   2,
+		Hasher:   func(key int) uint64 { return uint64(key) },
+	})
+	for i := 0; i < 10; i++ {
+		c.Put(i, i)
+	}
+	// even keys go to shard 0, odd keys to shard 1, each of capacity 4.
+	assert.Equal(t, map[int]int{6: 6, 8: 8, 7: 7, 9: 9, 4: 4, 5: 5, 2: 2, 3: 3}, c.DumpForTest())
+	assert.Equal(t, 4, c.segments[0].values.len())
+	_, found := c.segments[0].values.get(8)
+	assert.True(t, found)
+	_, found = c.segments[1].values.get(9)
+	assert.True(t, found)
+}
+
+const benchRegexKeySize = 1000
+
+var benchRegexKeys = func() []string {
+	keys := make([]string, benchRegexKeySize)
+	for i := range keys {
+		keys[i] = "^[a-z]+-" + strconv.Itoa(i) + "-[0-9]{2,4}$"
+	}
+	return keys
+}()
+
+func benchmarkConcurrentGet(b *testing.B, newCache func() *LoadingCache) {
+	for _, goroutines := range []int{1, 2, 4, 8, 16, 32, 64} {
+		b.Run(fmt.Sprintf("goroutines-%d", goroutines), func(b *testing.B) {
+			cache := newCache()
+			load := func(key interface{}) (interface{}, error) {
+				return regexp.Compile(key.(string))
+			}
+			// warm up the cache so that the benchmark measures the (contended) hit path.
+			for _, key := range benchRegexKeys {
+				_, _ = cache.Get(key, load)
+			}
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				n := b.N / goroutines
+				if g < b.N%goroutines {
+					n++
+				}
+				wg.Add(1)
+				go func(seed int64, n int) {
+					defer wg.Done()
+					r := rand.New(rand.NewSource(seed))
+					for i := 0; i < n; i++ {
+						_, _ = cache.Get(benchRegexKeys[r.Intn(benchRegexKeySize)], load)
+					}
+				}(int64(g), n)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkLoadingCache_ConcurrentGet_SingleLock(b *testing.B) {
+	benchmarkConcurrentGet(b, func() *LoadingCache { return NewLoadingCache() })
+}
+
+func BenchmarkLoadingCache_ConcurrentGet_16Shards(b *testing.B) {
+	benchmarkConcurrentGet(b, func() *LoadingCache { return NewShardedLoadingCache(16) })
+}
+
+func BenchmarkLoadingCache_ConcurrentGet_64Shards(b *testing.B) {
+	benchmarkConcurrentGet(b, func() *LoadingCache { return NewShardedLoadingCache(64) })
+}
@@ -0,0 +1,111 @@
+package caches
+
+import (
+	"time"
+)
+
+// EvictionReason tells why a value was removed from a LoadingCache.
+type EvictionReason int
+
+const (
+	// EvictionReasonCapacity means the value was evicted to make room under the cache capacity.
+	EvictionReasonCapacity EvictionReason = iota
+	// EvictionReasonExpired means the value was removed because it had expired.
+	EvictionReasonExpired
+	// EvictionReasonExplicit means the value was removed by an explicit invalidation from the caller.
+	EvictionReasonExplicit
+)
+
+// String implements fmt.Stringer interface for EvictionReason.
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionReasonCapacity:
+		return "capacity"
+	case EvictionReasonExpired:
+		return "expired"
+	case EvictionReasonExplicit:
+		return "explicit"
+	default:
+		return "unknown"
+	}
+}
+
+// LoadingCacheStats is a point-in-time snapshot of the statistics of a LoadingCache.
+type LoadingCacheStats struct {
+	// Hits is the number of Get calls (or keys looked up by GetAll) served by a cached value.
+	Hits int64
+	// ErrorHits is the number of Get calls (or keys looked up by GetAll) served by a negatively cached
+	// load error.
+	ErrorHits int64
+	// Misses is the number of Get calls (or keys looked up by GetAll) that found neither a cached value
+	// nor a cached error and had to either do a load or wait for an in-flight load.
+	Misses int64
+	// LoadSuccesses is the number of loads (including background refreshes) that returned a value. Loads
+	// served by the on-disk second level are counted as DiskHits instead.
+	LoadSuccesses int64
+	// LoadFailures is the number of loads (including background refreshes) that returned an error
+	// or panicked.
+	LoadFailures int64
+	// TotalLoadTime is the total time, measured by the cache's Clock, spent in loads.
+	TotalLoadTime time.Duration
+	// Evictions is the number of values removed from the cache due to capacity or expiration. Explicit
+	// removals (e.g. by Invalidate) are not counted.
+	Evictions int64
+	// Size is the number of values currently in the cache, including the expired ones that haven't
+	// been removed yet.
+	Size int
+	// Weight is the total weight of the values currently in the cache. Always 0 if no Weigher is used.
+	Weight int64
+	// DiskHits is the number of loads served by the on-disk second level (see DiskStore) instead of
+	// the load function. Always 0 if no DiskStore is used, as are all the other Disk* statistics.
+	DiskHits int64
+	// DiskCorruptions is the number of corrupted entries found (and deleted) in the on-disk second level.
+	DiskCorruptions int64
+	// DiskErrors is the number of I/O or encoding errors encountered by the on-disk second level. The
+	// cache keeps working despite such errors, only without the affected entries on disk.
+	DiskErrors int64
+	// DiskBytes is the total size of the entries currently in the on-disk second level.
+	DiskBytes int64
+}
+
+// HitRate returns the ratio of Get calls served by a cached value or error over all Get calls. It
+// returns 1 if there hasn't been any Get call.
+func (s LoadingCacheStats) HitRate() float64 {
+	hits := s.Hits + s.ErrorHits
+	total := hits + s.Misses
+	if total == 0 {
+		return 1
+	}
+	return float64(hits) / float64(total)
+}
+
+// Stats returns a snapshot of the cache statistics. For a sharded cache, it's the sum of all the
+// shards' statistics, each of which is taken individually.
+func (c *TypedLoadingCache[K, V]) Stats() LoadingCacheStats {
+	var total LoadingCacheStats
+	for _, s := range c.segments {
+		st := s.snapshotStats()
+		total.Hits += st.Hits
+		total.ErrorHits += st.ErrorHits
+		total.Misses += st.Misses
+		total.LoadSuccesses += st.LoadSuccesses
+		total.LoadFailures += st.LoadFailures
+		total.TotalLoadTime += st.TotalLoadTime
+		total.Evictions += st.Evictions
+		total.Size += st.Size
+		total.Weight += st.Weight
+	}
+	if c.disk != nil {
+		c.disk.snapshotStats(&total)
+	}
+	return total
+}
+
+func (s *segment[K, V]) snapshotStats() LoadingCacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Size = s.values.len()
+	st.Weight = s.values.totalWeight
+	return st
+}
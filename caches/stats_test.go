@@ -0,0 +1,115 @@
+package caches
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/testlib"
+)
+
+func TestEvictionReason_String(t *testing.T) {
+	assert.Equal(t, "capacity", EvictionReasonCapacity.String())
+	assert.Equal(t, "expired", EvictionReasonExpired.String())
+	assert.Equal(t, "explicit", EvictionReasonExplicit.String())
+	assert.Equal(t, "unknown", EvictionReason(99).String())
+}
+
+func TestLoadingCacheStats_HitRate(t *testing.T) {
+	assert.Equal(t, float64(1), LoadingCacheStats{}.HitRate())
+	assert.Equal(t, 0.75, LoadingCacheStats{Hits: 2, ErrorHits: 1, Misses: 1}.HitRate())
+	assert.Equal(t, float64(0), LoadingCacheStats{Misses: 3}.HitRate())
+}
+
+type evictionForTest struct {
+	key    string
+	val    int
+	reason EvictionReason
+}
+
+func TestTypedLoadingCache_StatsAndOnEviction(t *testing.T) {
+	clock := newMockClock()
+	var evictions []evictionForTest
+	var c *TypedLoadingCache[string, int]
+	c = NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		Capacity:         testlib.IntPtr(2),
+		ExpireAfterWrite: time.Hour,
+		ErrorMaxHits:     1,
+		Clock:            clock,
+		OnEviction: func(key string, val int, reason EvictionReason) {
+			// calling back into the cache from the listener must not deadlock.
+			_ = c.Stats()
+			evictions = append(evictions, evictionForTest{key, val, reason})
+		},
+	})
+	load := func(key string) (int, error) {
+		clock.Advance(time.Millisecond)
+		if key == "bad" {
+			return 0, errors.New("bad key")
+		}
+		return strconv.Atoi(key)
+	}
+	assert.Equal(t, LoadingCacheStats{}, c.Stats())
+
+	_, _ = c.Get("1", load)   // miss, load success
+	_, _ = c.Get("1", load)   // hit
+	_, _ = c.Get("2", load)   // miss, load success
+	_, _ = c.Get("3", load)   // miss, load success, "1" evicted due to capacity
+	_, _ = c.Get("bad", load) // miss, load failure
+	_, _ = c.Get("bad", load) // error hit
+	clock.Advance(time.Hour)
+	_, _ = c.Get("2", load) // "2" expired, miss, load success
+
+	assert.Equal(t, LoadingCacheStats{
+		Hits:          1,
+		ErrorHits:     1,
+		Misses:        5,
+		LoadSuccesses: 4,
+		LoadFailures:  1,
+		TotalLoadTime: 5 * time.Millisecond,
+		Evictions:     2,
+		Size:          2,
+	}, c.Stats())
+	assert.Equal(t, []evictionForTest{
+		{"1", 1, EvictionReasonCapacity},
+		{"2", 2, EvictionReasonExpired},
+	}, evictions)
+}
+
+func TestTypedLoadingCache_Stats_Weight(t *testing.T) {
+	var evictions []evictionForTest
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		Weigher:   func(key string, val int) int { return val },
+		MaxWeight: 10,
+		OnEviction: func(key string, val int, reason EvictionReason) {
+			evictions = append(evictions, evictionForTest{key, val, reason})
+		},
+	})
+	load := func(key string) (int, error) { return strconv.Atoi(key) }
+	for _, key := range []string{"3", "4", "2", "5"} {
+		_, _ = c.Get(key, load)
+	}
+	s := c.Stats()
+	assert.Equal(t, 2, s.Size)
+	assert.Equal(t, int64(7), s.Weight)
+	assert.Equal(t, int64(2), s.Evictions)
+	assert.Equal(t, map[string]int{"2": 2, "5": 5}, c.DumpForTest())
+	assert.Equal(t, []evictionForTest{
+		{"3", 3, EvictionReasonCapacity},
+		{"4", 4, EvictionReasonCapacity},
+	}, evictions)
+}
+
+func TestTypedLoadingCache_Stats_LoadPanicCountsAsFailure(t *testing.T) {
+	c := NewTypedLoadingCache[string, int]()
+	assert.Panics(t, func() {
+		_, _ = c.Get("key", func(key string) (int, error) { panic("boom") })
+	})
+	s := c.Stats()
+	assert.Equal(t, int64(1), s.Misses)
+	assert.Equal(t, int64(1), s.LoadFailures)
+	assert.Equal(t, int64(0), s.LoadSuccesses)
+}
@@ -0,0 +1,86 @@
+package caches
+
+import (
+	"fmt"
+	"time"
+)
+
+// store is a capacity (and optionally weight) bound map of entries, whose eviction order is decided
+// by a policy. Not thread-safe.
+type store[K comparable, V any] struct {
+	capacity    int
+	weigher     func(key K, val V) int // optional; if nil, maxWeight isn't enforced.
+	maxWeight   int64
+	totalWeight int64
+	entries     map[K]*entry[K, V]
+	policy      policy[K, V]
+	onEvict     func(e *entry[K, V]) // optional, called for each entry evicted due to capacity.
+}
+
+func newStore[K comparable, V any](capacity int, p policy[K, V]) *store[K, V] {
+	return &store[K, V]{capacity: capacity, entries: make(map[K]*entry[K, V]), policy: p}
+}
+
+func (s *store[K, V]) len() int {
+	return len(s.entries)
+}
+
+func (s *store[K, V]) get(key K) (*entry[K, V], bool) {
+	e, found := s.entries[key]
+	return e, found
+}
+
+// touch records a read access of the entry.
+func (s *store[K, V]) touch(e *entry[K, V]) {
+	s.policy.access(e)
+}
+
+func (s *store[K, V]) weigh(key K, val V) int64 {
+	if s.weigher == nil {
+		return 0
+	}
+	w := s.weigher(key, val)
+	if w < 0 {
+		panic(fmt.Errorf("weight must be >= 0, instead got: %d", w))
+	}
+	return int64(w)
+}
+
+func (s *store[K, V]) overLimit() bool {
+	return len(s.entries) > s.capacity || (s.weigher != nil && s.totalWeight > s.maxWeight)
+}
+
+// add inserts (or updates) the entry of the key, and evicts entries chosen by the policy if the
+// capacity or max weight is exceeded. Note an entry that alone weighs more than the max weight is
+// evicted right away.
+func (s *store[K, V]) add(key K, val V, now time.Time) {
+	weight := s.weigh(key, val)
+	e, found := s.entries[key]
+	if found {
+		s.totalWeight -= e.weight
+		e.val = val
+		e.writeTime, e.accessTime, e.hits = now, now, 0
+		s.policy.access(e)
+	} else {
+		e = &entry[K, V]{key: key, val: val, writeTime: now, accessTime: now}
+		s.entries[key] = e
+		s.policy.add(e)
+	}
+	e.weight = weight
+	s.totalWeight += weight
+	for s.overLimit() {
+		victim := s.policy.victim()
+		s.totalWeight -= victim.weight
+		delete(s.entries, victim.key)
+		if s.onEvict != nil {
+			s.onEvict(victim)
+		}
+	}
+}
+
+// remove removes the entry from the store, for reasons other than capacity eviction.
+func (s *store[K, V]) remove(e *entry[K, V]) {
+	s.policy.remove(e)
+	s.totalWeight -= e.weight
+	delete(s.entries, e.key)
+}
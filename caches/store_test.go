@@ -0,0 +1,94 @@
+package caches
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lruStoreKeysForTest[K comparable, V any](s *store[K, V]) []K {
+	return listKeysForTest(s.policy.(*lruPolicy[K, V]).l)
+}
+
+func TestStore(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newStore[string, int](3, newLRUPolicy[string, int]())
+	assert.Equal(t, 0, s.len())
+	s.add("a", 1, now)
+	s.add("b", 2, now)
+	s.add("c", 3, now)
+	assert.Equal(t, []string{"c", "b", "a"}, lruStoreKeysForTest(s))
+
+	e, found := s.get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, e.val)
+	e.hits = 5
+	s.touch(e)
+	assert.Equal(t, []string{"a", "c", "b"}, lruStoreKeysForTest(s))
+
+	// updating an existing entry resets its timestamps and hits.
+	later := now.Add(time.Minute)
+	s.add("a", 10, later)
+	e, _ = s.get("a")
+	assert.Equal(t, 10, e.val)
+	assert.Equal(t, later, e.writeTime)
+	assert.Equal(t, later, e.accessTime)
+	assert.Equal(t, 0, e.hits)
+	assert.Equal(t, 3, s.len())
+
+	// capacity exceeded, the policy's victim is evicted.
+	var evicted []string
+	s.onEvict = func(e *entry[string, int]) { evicted = append(evicted, e.key) }
+	s.add("d", 4, now)
+	assert.Equal(t, []string{"d", "a", "c"}, lruStoreKeysForTest(s))
+	assert.Equal(t, []string{"b"}, evicted)
+	_, found = s.get("b")
+	assert.False(t, found)
+
+	e, _ = s.get("a")
+	s.remove(e)
+	assert.Equal(t, []string{"d", "c"}, lruStoreKeysForTest(s))
+	assert.Equal(t, 2, s.len())
+	assert.Equal(t, []string{"b"}, evicted)
+}
+
+func TestStore_Weighted(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newStore[string, string](100, newLRUPolicy[string, string]())
+	s.weigher = func(key, val string) int { return len(val) }
+	s.maxWeight = 10
+	var evicted []string
+	s.onEvict = func(e *entry[string, string]) { evicted = append(evicted, e.key) }
+
+	s.add("a", "aaaa", now)
+	s.add("b", "bbbb", now)
+	assert.Equal(t, int64(8), s.totalWeight)
+	s.add("c", "cc", now)
+	assert.Equal(t, int64(10), s.totalWeight)
+	assert.Equal(t, []string{"c", "b", "a"}, lruStoreKeysForTest(s))
+	assert.Nil(t, evicted)
+
+	// updating an entry re-weighs it.
+	s.add("c", "c", now)
+	assert.Equal(t, int64(9), s.totalWeight)
+
+	// exceeding max weight evicts as many entries as needed.
+	s.add("d", "ddddddd", now)
+	assert.Equal(t, []string{"d", "c"}, lruStoreKeysForTest(s))
+	assert.Equal(t, []string{"a", "b"}, evicted)
+	assert.Equal(t, int64(8), s.totalWeight)
+
+	// an entry weighing more than max weight alone is evicted right away.
+	evicted = nil
+	s.add("e", "eeeeeeeeeee", now)
+	assert.Equal(t, 0, s.len())
+	assert.Equal(t, []string{"c", "d", "e"}, evicted)
+	assert.Equal(t, int64(0), s.totalWeight)
+
+	s.weigher = func(key, val string) int { return -1 }
+	assert.PanicsWithError(t, "weight must be >= 0, instead got: -1", func() {
+		s.add("f", "f", now)
+	})
+	assert.Equal(t, 0, s.len())
+}
@@ -0,0 +1,130 @@
+package caches
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StrftimeLayoutCache is the default loading cache used for caching the Go time layouts
+// converted from strftime formats, i.e. the StrftimeLayoutCacheName cache of DefaultCacheRegistry.
+// Be aware it's global so any packages uses this package inside your process will be affected
+// by replacing it; to customize the cache for your own use, create a CacheRegistry instead.
+var StrftimeLayoutCache = NewLoadingCache()
+
+// GetStrftimeLayout converts a given strftime format (e.g. "%Y-%m-%d %H:%M:%S") into a Go
+// time layout (e.g. "2006-01-02 15:04:05") usable by time.Parse and time.Time.Format, or
+// returns error, using DefaultCacheRegistry.
+//
+// Supported directives are %a %A %b %B %c %d %D %e %f %F %h %H %I %j %L %m %M %n %p %r %R
+// %S %t %T %x %X %y %Y %z %Z and %%, where %f is 6-digit microseconds and %L is 3-digit
+// milliseconds, both of which must follow a '.' or ','. Directives with no Go layout equivalent
+// (e.g. %U, %w, %s) are errors. So are literal texts Go would mistake for layout elements (e.g.
+// digits, "Jan", "Mon", "PM"), as a Go layout has no way to escape them.
+func GetStrftimeLayout(format string) (string, error) {
+	return defaultCacheRegistry.GetStrftimeLayout(format)
+}
+
+// GetStrftimeLayout converts a given strftime format into a Go time layout or returns
+// error, using the registry's StrftimeLayoutCacheName cache.
+func (r *CacheRegistry) GetStrftimeLayout(format string) (string, error) {
+	layout, err := r.Cache(StrftimeLayoutCacheName).Get(format, func(key interface{}) (interface{}, error) {
+		return strftimeToLayout(key.(string))
+	})
+	if err != nil {
+		return "", err
+	}
+	return layout.(string), nil
+}
+
+var strftimeDirectives = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'c': "Mon Jan _2 15:04:05 2006",
+	'd': "02",
+	'D': "01/02/06",
+	'e': "_2",
+	'f': "000000",
+	'F': "2006-01-02",
+	'h': "Jan",
+	'H': "15",
+	'I': "03",
+	'j': "002",
+	'L': "000",
+	'm': "01",
+	'M': "04",
+	'n': "\n",
+	'p': "PM",
+	'r': "03:04:05 PM",
+	'R': "15:04",
+	'S': "05",
+	't': "\t",
+	'T': "15:04:05",
+	'x': "01/02/06",
+	'X': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+	'%': "%",
+}
+
+// strftimeAmbiguousLiterals are the literal texts that would be taken as layout elements by Go.
+var strftimeAmbiguousLiterals = []string{"Jan", "Mon", "MST", "PM", "pm"}
+
+func strftimeToLayout(format string) (string, error) {
+	var layout strings.Builder
+	var literal strings.Builder
+	flushLiteral := func(next string) error {
+		lit := literal.String()
+		literal.Reset()
+		if strings.ContainsAny(lit, "0123456789") {
+			return fmt.Errorf("strftime format '%s' contains digits in literal text '%s'", format, lit)
+		}
+		for _, s := range strftimeAmbiguousLiterals {
+			if strings.Contains(lit, s) {
+				return fmt.Errorf("strftime format '%s' contains '%s' in literal text '%s'", format, s, lit)
+			}
+		}
+		// '_' followed by "_2" would be taken as "__2", the day of year.
+		if strings.HasSuffix(lit, "_") && strings.HasPrefix(next, "_") {
+			return fmt.Errorf("strftime format '%s' contains '_' right before %%e", format)
+		}
+		layout.WriteString(lit)
+		return nil
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal.WriteByte(format[i])
+			continue
+		}
+		if i+1 >= len(format) {
+			return "", fmt.Errorf("strftime format '%s' ends with an incomplete directive", format)
+		}
+		i++
+		directive, found := strftimeDirectives[format[i]]
+		if !found {
+			return "", fmt.Errorf("strftime format '%s' contains unsupported directive '%%%c'", format, format[i])
+		}
+		if directive == "%" {
+			// '%' is not special in Go layouts.
+			literal.WriteByte('%')
+			continue
+		}
+		if err := flushLiteral(directive); err != nil {
+			return "", err
+		}
+		if format[i] == 'f' || format[i] == 'L' {
+			// Go only takes a run of 0s for fractional seconds right after a '.' or ','.
+			if l := layout.String(); l == "" || (l[len(l)-1] != '.' && l[len(l)-1] != ',') {
+				return "", fmt.Errorf("strftime format '%s' must have '.' or ',' right before '%%%c'", format, format[i])
+			}
+		}
+		layout.WriteString(directive)
+	}
+	if err := flushLiteral(""); err != nil {
+		return "", err
+	}
+	return layout.String(), nil
+}
@@ -0,0 +1,98 @@
+package caches
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStrftimeLayout(t *testing.T) {
+	StrftimeLayoutCache = NewLoadingCache()
+	assert.Equal(t, 0, len(StrftimeLayoutCache.DumpForTest()))
+	// failure case
+	layout, err := GetStrftimeLayout("%Y-%U")
+	assert.Error(t, err)
+	assert.Equal(t, "strftime format '%Y-%U' contains unsupported directive '%U'", err.Error())
+	assert.Equal(t, "", layout)
+	assert.Equal(t, 0, len(StrftimeLayoutCache.DumpForTest()))
+	// success case
+	layout, err = GetStrftimeLayout("%Y-%m-%d %H:%M:%S")
+	assert.NoError(t, err)
+	assert.Equal(t, "2006-01-02 15:04:05", layout)
+	assert.Equal(t, 1, len(StrftimeLayoutCache.DumpForTest()))
+	// repeat success case shouldn't case any cache growth
+	layout, err = GetStrftimeLayout("%Y-%m-%d %H:%M:%S")
+	assert.NoError(t, err)
+	assert.Equal(t, "2006-01-02 15:04:05", layout)
+	assert.Equal(t, 1, len(StrftimeLayoutCache.DumpForTest()))
+}
+
+func TestCacheRegistry_GetStrftimeLayout(t *testing.T) {
+	StrftimeLayoutCache = NewLoadingCache()
+	r := NewCacheRegistry()
+	layout, err := r.GetStrftimeLayout("%F")
+	assert.NoError(t, err)
+	assert.Equal(t, "2006-01-02", layout)
+	_, err = r.GetStrftimeLayout("%")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(r.Cache(StrftimeLayoutCacheName).DumpForTest()))
+	// the registry is isolated from the default one.
+	assert.Equal(t, 0, len(StrftimeLayoutCache.DumpForTest()))
+}
+
+func TestStrftimeToLayout(t *testing.T) {
+	tm := time.Date(2021, time.March, 7, 14, 5, 9, 123456789, time.FixedZone("PST", -8*3600))
+	for _, test := range []struct {
+		format         string
+		expectedLayout string
+		expectedErr    string
+		expectedFormat string
+	}{
+		{
+			format:         "%Y-%m-%dT%H:%M:%S%z",
+			expectedLayout: "2006-01-02T15:04:05-0700",
+			expectedFormat: "2021-03-07T14:05:09-0800",
+		},
+		{
+			format:         "%a, %d %b %y %I:%M:%S %p %Z",
+			expectedLayout: "Mon, 02 Jan 06 03:04:05 PM MST",
+			expectedFormat: "Sun, 07 Mar 21 02:05:09 PM PST",
+		},
+		{
+			format:         "%A %B %e, day %j",
+			expectedLayout: "Monday January _2, day 002",
+			expectedFormat: "Sunday March  7, day 066",
+		},
+		{format: "%c", expectedLayout: "Mon Jan _2 15:04:05 2006", expectedFormat: "Sun Mar  7 14:05:09 2021"},
+		{format: "%D %T", expectedLayout: "01/02/06 15:04:05", expectedFormat: "03/07/21 14:05:09"},
+		{format: "%x %X", expectedLayout: "01/02/06 15:04:05", expectedFormat: "03/07/21 14:05:09"},
+		{format: "%R %r", expectedLayout: "15:04 03:04:05 PM", expectedFormat: "14:05 02:05:09 PM"},
+		{format: "%h%n%t", expectedLayout: "Jan\n\t", expectedFormat: "Mar\n\t"},
+		{format: "%S.%f", expectedLayout: "05.000000", expectedFormat: "09.123456"},
+		{format: "%S,%L", expectedLayout: "05,000", expectedFormat: "09,123"},
+		{format: "100%% at %H", expectedErr: "strftime format '100%% at %H' contains digits in literal text '100% at '"},
+		{format: "%% at %H", expectedLayout: "% at 15", expectedFormat: "% at 14"},
+		{format: "", expectedLayout: "", expectedFormat: ""},
+		{format: "plain", expectedLayout: "plain", expectedFormat: "plain"},
+		{format: "%Y%", expectedErr: "strftime format '%Y%' ends with an incomplete directive"},
+		{format: "%s", expectedErr: "strftime format '%s' contains unsupported directive '%s'"},
+		{format: "Month %m", expectedErr: "strftime format 'Month %m' contains 'Mon' in literal text 'Month '"},
+		{format: "%H PM", expectedErr: "strftime format '%H PM' contains 'PM' in literal text ' PM'"},
+		{format: "%Y_%e", expectedErr: "strftime format '%Y_%e' contains '_' right before %e"},
+		{format: "%S%f", expectedErr: "strftime format '%S%f' must have '.' or ',' right before '%f'"},
+		{format: "%L", expectedErr: "strftime format '%L' must have '.' or ',' right before '%L'"},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			layout, err := strftimeToLayout(test.format)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Equal(t, "", layout)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedLayout, layout)
+			assert.Equal(t, test.expectedFormat, tm.Format(layout))
+		})
+	}
+}
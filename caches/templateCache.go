@@ -0,0 +1,31 @@
+package caches
+
+import (
+	"text/template"
+)
+
+// TemplateCache is the default loading cache used for caching the parsed text/template
+// templates, i.e. the TemplateCacheName cache of DefaultCacheRegistry. Be aware it's
+// global so any packages uses this package inside your process will be affected by replacing
+// it; to customize the cache for your own use, create a CacheRegistry instead.
+var TemplateCache = NewLoadingCache()
+
+// GetTemplate parses a given text/template text and returns a parsed *template.Template
+// or error, using DefaultCacheRegistry. The returned template is shared by all the callers
+// of the same text, so it must not be modified (e.g. by Funcs or Parse); Clone it first if
+// needed. Note the template is parsed without any custom functions.
+func GetTemplate(text string) (*template.Template, error) {
+	return defaultCacheRegistry.GetTemplate(text)
+}
+
+// GetTemplate parses a given text/template text and returns a parsed *template.Template
+// or error, using the registry's TemplateCacheName cache.
+func (r *CacheRegistry) GetTemplate(text string) (*template.Template, error) {
+	tmpl, err := r.Cache(TemplateCacheName).Get(text, func(key interface{}) (interface{}, error) {
+		return template.New("").Parse(key.(string))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.(*template.Template), nil
+}
@@ -0,0 +1,44 @@
+package caches
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTemplate(t *testing.T) {
+	TemplateCache = NewLoadingCache()
+	assert.Equal(t, 0, len(TemplateCache.DumpForTest()))
+	// failure case
+	tmpl, err := GetTemplate("{{.Name")
+	assert.Error(t, err)
+	assert.Equal(t, "template: :1: unclosed action", err.Error())
+	assert.Nil(t, tmpl)
+	assert.Equal(t, 0, len(TemplateCache.DumpForTest()))
+	// success case
+	tmpl, err = GetTemplate("hello {{.Name}}")
+	assert.NoError(t, err)
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, map[string]string{"Name": "world"}))
+	assert.Equal(t, "hello world", sb.String())
+	assert.Equal(t, 1, len(TemplateCache.DumpForTest()))
+	// repeat success case shouldn't case any cache growth
+	tmpl2, err := GetTemplate("hello {{.Name}}")
+	assert.NoError(t, err)
+	assert.True(t, tmpl == tmpl2)
+	assert.Equal(t, 1, len(TemplateCache.DumpForTest()))
+}
+
+func TestCacheRegistry_GetTemplate(t *testing.T) {
+	TemplateCache = NewLoadingCache()
+	r := NewCacheRegistry()
+	tmpl, err := r.GetTemplate("{{.}}")
+	assert.NoError(t, err)
+	assert.NotNil(t, tmpl)
+	_, err = r.GetTemplate("{{")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(r.Cache(TemplateCacheName).DumpForTest()))
+	// the registry is isolated from the default one.
+	assert.Equal(t, 0, len(TemplateCache.DumpForTest()))
+}
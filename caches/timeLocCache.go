@@ -1,23 +1,111 @@
 package caches
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // TimeLocationCache is the default loading cache used for caching *time.Location
-// object If the default size is too big/small and/or a cache limit isn't desired
-// at all, caller can simply replace the cache during global initialization. But
-// be aware it's global so any packages uses this package inside your process will
-// be affected.
+// object, i.e. the TimeLocationCacheName cache of DefaultCacheRegistry. Be aware it's
+// global so any packages uses this package inside your process will be affected by
+// replacing it; to customize the cache for your own use, create a CacheRegistry instead.
 var TimeLocationCache = NewLoadingCache()
 
-// GetTimeLocation loads a time.Location object based on IANA time zone string.
+// AmbiguousAbbrPolicy tells how to resolve a time zone abbreviation used by multiple time
+// zones, e.g. "IST" is used by India, Ireland and Israel.
+type AmbiguousAbbrPolicy int
+
+const (
+	// AmbiguousAbbrPreferred resolves an ambiguous abbreviation to its most widely used time
+	// zone, e.g. "IST" to "Asia/Kolkata" and "CST" to "America/Chicago".
+	AmbiguousAbbrPreferred AmbiguousAbbrPolicy = iota
+	// AmbiguousAbbrError fails the resolution of an ambiguous abbreviation.
+	AmbiguousAbbrError
+)
+
+// TimeLocationOptions tells GetTimeLocationWithOptions how to resolve a time zone string.
+type TimeLocationOptions struct {
+	// AmbiguousAbbr tells how to resolve an abbreviation used by multiple time zones.
+	AmbiguousAbbr AmbiguousAbbrPolicy
+}
+
+type timeLocationKey struct {
+	tz   string
+	opts TimeLocationOptions
+}
+
+// GetTimeLocation loads a time.Location object based on a time zone string, using
+// DefaultCacheRegistry. See GetTimeLocationWithOptions for the accepted time zone strings;
+// ambiguous abbreviations are resolved by AmbiguousAbbrPreferred.
 func GetTimeLocation(tz string) (*time.Location, error) {
-	loc, err := TimeLocationCache.Get(tz, func(key interface{}) (interface{}, error) {
-		return time.LoadLocation(key.(string))
-	})
+	return defaultCacheRegistry.GetTimeLocation(tz)
+}
+
+// GetTimeLocation loads a time.Location object based on a time zone string, using
+// the registry's TimeLocationCacheName cache.
+func (r *CacheRegistry) GetTimeLocation(tz string) (*time.Location, error) {
+	return r.GetTimeLocationWithOptions(tz, TimeLocationOptions{})
+}
+
+// GetTimeLocationWithOptions loads a time.Location object based on a time zone string, using
+// DefaultCacheRegistry. Besides IANA time zone names (e.g. "America/New_York") and anything else
+// time.LoadLocation accepts (falling back to the tz database registered by RegisterTZData, if
+// any), the time zone string can be:
+//   - a fixed offset, e.g. "+05:30", "-0700", "+09", "UTC-7" or "GMT+5:30", resolved to a
+//     time.FixedZone named by the string.
+//   - a Windows time zone name, e.g. "Pacific Standard Time", resolved to its IANA time zone.
+//   - a time zone abbreviation, e.g. "PST", resolved to an IANA time zone using it. Note an
+//     abbreviation is resolved to the time zone, not to its offset, e.g. both "PST" and "PDT"
+//     are resolved to "America/Los_Angeles". IANA time zone names take precedence, so the few
+//     abbreviations which are IANA time zones themselves (e.g. "EST", "MST", "HST" or "CET")
+//     are resolved as such.
+func GetTimeLocationWithOptions(tz string, opts TimeLocationOptions) (*time.Location, error) {
+	return defaultCacheRegistry.GetTimeLocationWithOptions(tz, opts)
+}
+
+// GetTimeLocationWithOptions loads a time.Location object based on a time zone string, using
+// the registry's TimeLocationCacheName cache.
+func (r *CacheRegistry) GetTimeLocationWithOptions(tz string, opts TimeLocationOptions) (*time.Location, error) {
+	loc, err := r.Cache(TimeLocationCacheName).Get(timeLocationKey{tz: tz, opts: opts},
+		func(key interface{}) (interface{}, error) {
+			return loadTimeLocation(key.(timeLocationKey))
+		})
 	if err != nil {
 		return nil, err
 	}
 	return loc.(*time.Location), nil
 }
+
+var fixedOffsetRegex = regexp.MustCompile(`^(?:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+func loadTimeLocation(key timeLocationKey) (*time.Location, error) {
+	loc, err := loadLocation(key.tz)
+	if err == nil {
+		return loc, nil
+	}
+	if m := fixedOffsetRegex.FindStringSubmatch(key.tz); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi("0" + m[3])
+		if hours <= 14 && minutes < 60 {
+			offset := hours*3600 + minutes*60
+			if m[1] == "-" {
+				offset = -offset
+			}
+			return time.FixedZone(key.tz, offset), nil
+		}
+	}
+	if name, found := windowsTimeZones[key.tz]; found {
+		return loadLocation(name)
+	}
+	if names, found := timeZoneAbbrs[key.tz]; found {
+		if len(names) > 1 && key.opts.AmbiguousAbbr == AmbiguousAbbrError {
+			return nil, fmt.Errorf("ambiguous time zone abbreviation %s: %s", key.tz, strings.Join(names, ", "))
+		}
+		return loadLocation(names[0])
+	}
+	// none of the above; return the error about the time zone not being an IANA one.
+	return nil, err
+}
@@ -2,6 +2,7 @@ package caches
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,3 +27,89 @@ func TestGetTimeLocation(t *testing.T) {
 	assert.NotNil(t, expr)
 	assert.Equal(t, 1, len(TimeLocationCache.DumpForTest()))
 }
+
+func TestCacheRegistry_GetTimeLocation(t *testing.T) {
+	TimeLocationCache = NewLoadingCache()
+	r := NewCacheRegistry()
+	loc, err := r.GetTimeLocation("America/New_York")
+	assert.NoError(t, err)
+	assert.Equal(t, "America/New_York", loc.String())
+	_, err = r.GetTimeLocation("unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(r.Cache(TimeLocationCacheName).DumpForTest()))
+	// the registry is isolated from the default one.
+	assert.Equal(t, 0, len(TimeLocationCache.DumpForTest()))
+}
+
+func TestGetTimeLocationWithOptions(t *testing.T) {
+	TimeLocationCache = NewLoadingCache()
+	at := time.Date(2021, time.July, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name           string
+		tz             string
+		opts           TimeLocationOptions
+		expectedName   string
+		expectedOffset int
+		expectedErr    string
+	}{
+		{name: "IANA", tz: "Asia/Tokyo", expectedName: "Asia/Tokyo", expectedOffset: 9 * 3600},
+		{name: "IANA abbreviation", tz: "EST", expectedName: "EST", expectedOffset: -5 * 3600},
+		{name: "offset hh:mm", tz: "+05:30", expectedName: "+05:30", expectedOffset: 5*3600 + 30*60},
+		{name: "offset hhmm", tz: "-0700", expectedName: "-0700", expectedOffset: -7 * 3600},
+		{name: "offset hh", tz: "+09", expectedName: "+09", expectedOffset: 9 * 3600},
+		{name: "UTC offset", tz: "UTC-7", expectedName: "UTC-7", expectedOffset: -7 * 3600},
+		{name: "GMT offset", tz: "GMT+5:45", expectedName: "GMT+5:45", expectedOffset: 5*3600 + 45*60},
+		{name: "offset out of range", tz: "+15:00", expectedErr: "unknown time zone +15:00"},
+		{name: "offset bad minutes", tz: "+05:60", expectedErr: "unknown time zone +05:60"},
+		{name: "windows", tz: "Pacific Standard Time", expectedName: "America/Los_Angeles", expectedOffset: -7 * 3600},
+		{name: "windows 2", tz: "W. Europe Standard Time", expectedName: "Europe/Berlin", expectedOffset: 2 * 3600},
+		{name: "abbreviation", tz: "PDT", expectedName: "America/Los_Angeles", expectedOffset: -7 * 3600},
+		{name: "abbreviation 2", tz: "AEST", expectedName: "Australia/Sydney", expectedOffset: 10 * 3600},
+		{name: "ambiguous abbreviation preferred", tz: "IST", expectedName: "Asia/Kolkata", expectedOffset: 5*3600 + 30*60},
+		{
+			name:        "ambiguous abbreviation error",
+			tz:          "IST",
+			opts:        TimeLocationOptions{AmbiguousAbbr: AmbiguousAbbrError},
+			expectedErr: "ambiguous time zone abbreviation IST: Asia/Kolkata, Europe/Dublin, Asia/Jerusalem",
+		},
+		{
+			name:           "unambiguous abbreviation with error policy",
+			tz:             "JST",
+			opts:           TimeLocationOptions{AmbiguousAbbr: AmbiguousAbbrError},
+			expectedName:   "Asia/Tokyo",
+			expectedOffset: 9 * 3600,
+		},
+		{name: "unknown", tz: "Nowhere Standard Time", expectedErr: "unknown time zone Nowhere Standard Time"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			loc, err := GetTimeLocationWithOptions(test.tz, test.opts)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Nil(t, loc)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedName, loc.String())
+			_, offset := at.In(loc).Zone()
+			assert.Equal(t, test.expectedOffset, offset)
+		})
+	}
+}
+
+func TestTimeZoneTables(t *testing.T) {
+	// every time zone in the tables must be loadable.
+	for name, tz := range windowsTimeZones {
+		_, err := time.LoadLocation(tz)
+		assert.NoError(t, err, name)
+	}
+	for abbr, tzs := range timeZoneAbbrs {
+		// an abbreviation which is an IANA time zone name is never looked up.
+		_, err := time.LoadLocation(abbr)
+		assert.Error(t, err, abbr)
+		assert.NotEmpty(t, tzs, abbr)
+		for _, tz := range tzs {
+			_, err := time.LoadLocation(tz)
+			assert.NoError(t, err, abbr)
+		}
+	}
+}
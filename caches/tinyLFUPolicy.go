@@ -0,0 +1,186 @@
+package caches
+
+import (
+	"github.com/jf-tech/go-corelib/maths"
+)
+
+// countMinSketch estimates the access frequencies of keys with a fixed amount of memory, using 4 rows
+// of saturating 4-bit counters (each stored in a byte for simplicity). To keep the estimates fresh,
+// all counters are halved once the number of increments reaches the sample size.
+type countMinSketch struct {
+	rows       [4][]uint8
+	mask       uint64
+	increments int
+	sampleSize int
+}
+
+const (
+	sketchMinWidth   = 64
+	sketchMaxWidth   = 1 << 16
+	sketchMaxCounter = 15
+)
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := sketchMinWidth
+	for width < capacity && width < sketchMaxWidth {
+		width <<= 1
+	}
+	s := &countMinSketch{mask: uint64(width - 1), sampleSize: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	// double hashing: derives the per-row hashes from the two halves of the key's 64-bit hash.
+	return (h + uint64(row)*((h>>32)|1)) & s.mask
+}
+
+func (s *countMinSketch) increment(h uint64) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < sketchMaxCounter {
+			*c++
+		}
+	}
+	s.increments++
+	if s.increments >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(h uint64) uint8 {
+	est := uint8(sketchMaxCounter)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(h, i)]; c < est {
+			est = c
+		}
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.increments /= 2
+}
+
+const (
+	tinyLFUWindow uint8 = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+const (
+	tinyLFUWindowRatio    = 0.01 // the window's share of the capacity.
+	tinyLFUProtectedRatio = 0.8  // the protected segment's share of the main area.
+)
+
+// tinyLFUPolicy implements the W-TinyLFU policy as described in "TinyLFU: A Highly Efficient Cache
+// Admission Policy" by G. Einziger, R. Friedman and B. Manes: new entries enter a small LRU window;
+// entries overflowing the window compete with the eviction candidate of the main area, which is a
+// segmented LRU (probation + protected), and the one with the lower estimated frequency is evicted.
+type tinyLFUPolicy[K comparable, V any] struct {
+	hasher                       func(K) uint64
+	sketch                       *countMinSketch
+	windowCap, mainCap, protCap  int
+	window, probation, protected *entryList[K, V]
+}
+
+func newTinyLFUPolicy[K comparable, V any](capacity int, hasher func(K) uint64) *tinyLFUPolicy[K, V] {
+	windowCap := maths.MaxInt(1, int(float64(capacity)*tinyLFUWindowRatio))
+	mainCap := maths.MaxInt(1, capacity-windowCap)
+	return &tinyLFUPolicy[K, V]{
+		hasher:    hasher,
+		sketch:    newCountMinSketch(capacity),
+		windowCap: windowCap,
+		mainCap:   mainCap,
+		protCap:   maths.MaxInt(1, int(float64(mainCap)*tinyLFUProtectedRatio)),
+		window:    newEntryList[K, V](),
+		probation: newEntryList[K, V](),
+		protected: newEntryList[K, V](),
+	}
+}
+
+func (p *tinyLFUPolicy[K, V]) add(e *entry[K, V]) {
+	p.sketch.increment(p.hasher(e.key))
+	e.queue = tinyLFUWindow
+	p.window.pushFront(e)
+	// while the main area has room, entries overflowing the window move into it unconditionally.
+	for p.window.len() > p.windowCap && p.probation.len()+p.protected.len() < p.mainCap {
+		w := p.window.back()
+		p.window.remove(w)
+		w.queue = tinyLFUProbation
+		p.probation.pushFront(w)
+	}
+}
+
+func (p *tinyLFUPolicy[K, V]) access(e *entry[K, V]) {
+	p.sketch.increment(p.hasher(e.key))
+	switch e.queue {
+	case tinyLFUWindow:
+		p.window.moveToFront(e)
+	case tinyLFUProbation:
+		p.probation.remove(e)
+		e.queue = tinyLFUProtected
+		p.protected.pushFront(e)
+		if p.protected.len() > p.protCap {
+			demoted := p.protected.back()
+			p.protected.remove(demoted)
+			demoted.queue = tinyLFUProbation
+			p.probation.pushFront(demoted)
+		}
+	default:
+		p.protected.moveToFront(e)
+	}
+}
+
+func (p *tinyLFUPolicy[K, V]) listOf(e *entry[K, V]) *entryList[K, V] {
+	switch e.queue {
+	case tinyLFUWindow:
+		return p.window
+	case tinyLFUProbation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+func (p *tinyLFUPolicy[K, V]) remove(e *entry[K, V]) {
+	p.listOf(e).remove(e)
+}
+
+func (p *tinyLFUPolicy[K, V]) mainVictim() *entry[K, V] {
+	if e := p.probation.back(); e != nil {
+		return e
+	}
+	return p.protected.back()
+}
+
+func (p *tinyLFUPolicy[K, V]) victim() *entry[K, V] {
+	candidate := p.window.back()
+	mainVictim := p.mainVictim()
+	var loser *entry[K, V]
+	switch {
+	case candidate == nil:
+		loser = mainVictim
+	case mainVictim == nil:
+		loser = candidate
+	case p.window.len() <= p.windowCap:
+		// the window isn't overflowing (e.g. evicting due to weight); evict from the main area.
+		loser = mainVictim
+	case p.sketch.estimate(p.hasher(candidate.key)) > p.sketch.estimate(p.hasher(mainVictim.key)):
+		// the candidate is admitted into the main area, pushing out the main area's victim.
+		p.window.remove(candidate)
+		candidate.queue = tinyLFUProbation
+		p.probation.pushFront(candidate)
+		loser = mainVictim
+	default:
+		loser = candidate
+	}
+	p.remove(loser)
+	return loser
+}
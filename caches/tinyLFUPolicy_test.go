@@ -0,0 +1,98 @@
+package caches
+
+import (
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fnvHashForTest(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(10)
+	assert.Equal(t, sketchMinWidth, len(s.rows[0]))
+	assert.Equal(t, sketchMaxWidth, len(newCountMinSketch(1 << 20).rows[0]))
+
+	a, b := fnvHashForTest("a"), fnvHashForTest("b")
+	assert.Equal(t, uint8(0), s.estimate(a))
+	for i := 0; i < 3; i++ {
+		s.increment(a)
+	}
+	assert.Equal(t, uint8(3), s.estimate(a))
+	assert.Equal(t, uint8(0), s.estimate(b))
+	// counters saturate.
+	for i := 0; i < 20; i++ {
+		s.increment(a)
+	}
+	assert.Equal(t, uint8(sketchMaxCounter), s.estimate(a))
+	// counters are halved once the increments reach the sample size.
+	s.increments = s.sampleSize - 1
+	s.increment(b)
+	assert.Equal(t, uint8(sketchMaxCounter/2), s.estimate(a))
+	assert.Equal(t, uint8(0), s.estimate(b))
+	assert.Equal(t, s.sampleSize/2, s.increments)
+}
+
+func newTinyLFUStoreForTest(capacity int) (*policyStoreForTest, *tinyLFUPolicy[string, int]) {
+	s := newPolicyStoreForTest(EvictionPolicyWTinyLFU, capacity)
+	p := s.policy.(*tinyLFUPolicy[string, int])
+	// a fixed hasher keeps the sketch estimates, thus the test, deterministic.
+	p.hasher = fnvHashForTest
+	return s, p
+}
+
+func TestTinyLFUPolicy(t *testing.T) {
+	s, p := newTinyLFUStoreForTest(3)
+	assert.Equal(t, 1, p.windowCap)
+	assert.Equal(t, 2, p.mainCap)
+	assert.Equal(t, 1, p.protCap)
+
+	// entries overflowing the window go into the main area while it has room.
+	s.access("a", "b", "c")
+	assert.Equal(t, 0, len(s.evicted))
+	assert.Equal(t, tinyLFUWindow, s.entries["c"].queue)
+	assert.Equal(t, tinyLFUProbation, s.entries["a"].queue)
+
+	// c is no more frequent than a (the main area's victim), so it isn't admitted.
+	s.access("d")
+	assert.Equal(t, []string{"c"}, s.evicted)
+
+	// e is, so it's admitted into the main area, pushing a out.
+	s.access("e", "e", "e", "f")
+	assert.Equal(t, []string{"c", "d", "a"}, s.evicted)
+	assert.Equal(t, tinyLFUProbation, s.entries["e"].queue)
+
+	// an access in probation promotes the entry to protected, demoting protected's lru entry if full.
+	s.access("b")
+	assert.Equal(t, tinyLFUProtected, s.entries["b"].queue)
+	s.access("e")
+	assert.Equal(t, tinyLFUProtected, s.entries["e"].queue)
+	assert.Equal(t, tinyLFUProbation, s.entries["b"].queue)
+	s.access("e", "f")
+	assert.Equal(t, tinyLFUProtected, s.entries["e"].queue)
+	assert.Equal(t, tinyLFUWindow, s.entries["f"].queue)
+
+	// without window overflow (e.g. a weight eviction), the main area's victim is evicted.
+	assert.Equal(t, "b", p.victim().key)
+	assert.Equal(t, "e", p.victim().key)
+	assert.Equal(t, "f", p.victim().key)
+}
+
+func TestTinyLFUPolicy_ScanResistance(t *testing.T) {
+	s, _ := newTinyLFUStoreForTest(100)
+	hot := scanKeys("hot", 60)
+	for i := 0; i < 5; i++ {
+		s.access(hot...)
+	}
+	// one-off keys mixed with the hot set don't push the hot entries out.
+	for i, key := range scanKeys("scan", 1000) {
+		s.access(key, hot[i%len(hot)])
+	}
+	assert.True(t, s.has(hot...))
+	assert.Equal(t, 100, s.len())
+}
@@ -0,0 +1,74 @@
+package caches
+
+import (
+	"github.com/jf-tech/go-corelib/maths"
+)
+
+const (
+	twoQueueA1in uint8 = iota // resident entries seen once, in FIFO order.
+	twoQueueAm                // resident entries seen again after being evicted from a1in, in LRU order.
+)
+
+const (
+	twoQueueKinRatio  = 0.25 // a1in's share of the capacity.
+	twoQueueKoutRatio = 0.5  // a1out's (ghost) size relative to the capacity.
+)
+
+// twoQueuePolicy implements the full version of the 2Q policy as described in "2Q: A Low Overhead High
+// Performance Buffer Management Replacement Algorithm" by T. Johnson and D. Shasha.
+type twoQueuePolicy[K comparable, V any] struct {
+	kin, kout int
+	a1in, am  *entryList[K, V]
+	a1out     *ghostList[K]
+}
+
+func newTwoQueuePolicy[K comparable, V any](capacity int) *twoQueuePolicy[K, V] {
+	return &twoQueuePolicy[K, V]{
+		kin:   maths.MaxInt(1, int(float64(capacity)*twoQueueKinRatio)),
+		kout:  maths.MaxInt(1, int(float64(capacity)*twoQueueKoutRatio)),
+		a1in:  newEntryList[K, V](),
+		am:    newEntryList[K, V](),
+		a1out: newGhostList[K](),
+	}
+}
+
+func (p *twoQueuePolicy[K, V]) add(e *entry[K, V]) {
+	if p.a1out.remove(e.key) {
+		e.queue = twoQueueAm
+		p.am.pushFront(e)
+		return
+	}
+	e.queue = twoQueueA1in
+	p.a1in.pushFront(e)
+}
+
+func (p *twoQueuePolicy[K, V]) access(e *entry[K, V]) {
+	// a1in is a FIFO: accesses of the entries in it are deliberately ignored, so that correlated
+	// references (e.g. a scan touching an entry a few times in a row) don't promote it.
+	if e.queue == twoQueueAm {
+		p.am.moveToFront(e)
+	}
+}
+
+func (p *twoQueuePolicy[K, V]) remove(e *entry[K, V]) {
+	if e.queue == twoQueueA1in {
+		p.a1in.remove(e)
+	} else {
+		p.am.remove(e)
+	}
+}
+
+func (p *twoQueuePolicy[K, V]) victim() *entry[K, V] {
+	if p.a1in.len() > 0 && (p.a1in.len() > p.kin || p.am.len() == 0) {
+		e := p.a1in.back()
+		p.a1in.remove(e)
+		p.a1out.pushFront(e.key)
+		for p.a1out.len() > p.kout {
+			p.a1out.removeBack()
+		}
+		return e
+	}
+	e := p.am.back()
+	p.am.remove(e)
+	return e
+}
@@ -0,0 +1,46 @@
+package caches
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwoQueuePolicy(t *testing.T) {
+	s := newPolicyStoreForTest(EvictionPolicy2Q, 8)
+	p := s.policy.(*twoQueuePolicy[string, int])
+	assert.Equal(t, 2, p.kin)
+	assert.Equal(t, 4, p.kout)
+
+	s.access(scanKeys("x", 8)...)
+	assert.Equal(t, 0, len(s.evicted))
+	// accesses of entries in a1in don't promote them.
+	s.access("x7", "x7", "x7")
+	assert.Equal(t, twoQueueA1in, s.entries["x7"].queue)
+
+	// a1in is over kin, so the oldest entry in it is evicted and remembered in a1out.
+	s.access("y")
+	assert.Equal(t, []string{"x0"}, s.evicted)
+	assert.Equal(t, 1, p.a1out.len())
+
+	// x0 is seen again while remembered in a1out, so it goes into am.
+	s.access("x0")
+	assert.Equal(t, twoQueueAm, s.entries["x0"].queue)
+	assert.Equal(t, []string{"x0", "x1"}, s.evicted)
+
+	// x0 survives a scan of one-off keys, and a1out is bounded by kout.
+	s.access(scanKeys("z", 20)...)
+	assert.True(t, s.has("x0"))
+	assert.Equal(t, 4, p.a1out.len())
+
+}
+
+func TestTwoQueuePolicy_EvictFromAm(t *testing.T) {
+	s := newPolicyStoreForTest(EvictionPolicy2Q, 4)
+	s.access("a", "b", "c", "d", "e", "a", "b", "c")
+	assert.Equal(t, []string{"a", "b", "c", "d"}, s.evicted)
+	// a1in only has e, which isn't over kin, so bringing back d evicts am's lru entry.
+	s.access("d")
+	assert.Equal(t, []string{"a", "b", "c", "d", "a"}, s.evicted)
+	assert.True(t, s.has("b", "c", "d", "e"))
+}
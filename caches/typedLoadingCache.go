@@ -0,0 +1,324 @@
+package caches
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jf-tech/go-corelib/maths"
+)
+
+// TypedLoadingCache is the generic, type-safe version of LoadingCache: a key/value cache with a user
+// specified loading function and an optional capacity. If a key isn't present in the cache, load function
+// will be called to create a value for the key and the value will be stored into the cache as well as
+// returned to the caller. Capacity semantics are identical to LoadingCache's. Because keys and values are
+// stored in their concrete types, there is no type assertion needed on the caller side and no boxing
+// allocation on lookups. The cache is thread-safe, and concurrent misses on the same key share a single
+// in-flight load.
+//
+// By default, a TypedLoadingCache is guarded by a single lock. For highly concurrent workloads, it can be
+// created with multiple shards (see TypedLoadingCacheOptions.Shards), each of which is an independently
+// locked segment owning a share of the keys and of the cache limits.
+type TypedLoadingCache[K comparable, V any] struct {
+	capacity int
+	clock    Clock
+	hasher   func(key K) uint64
+	segments []*segment[K, V]
+	disk     *diskStore[K, V]
+}
+
+// Clock tells the current time. It has the same method set as times.Clock (which can't be referenced
+// here because package times depends on package caches), so any times.Clock can be used as a Clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type osClock struct{}
+
+func (osClock) Now() time.Time {
+	return time.Now()
+}
+
+// TypedLoadingCacheOptions customizes a TypedLoadingCache created by NewTypedLoadingCacheEx.
+type TypedLoadingCacheOptions[K comparable, V any] struct {
+	// Capacity is the max number of entries in the cache. nil means a reasonable default capacity
+	// is used; 0 means no limit - be careful of unlimited cache growth.
+	Capacity *int
+	// EvictionPolicy decides which values are evicted when the cache is over its Capacity or MaxWeight.
+	// The zero value is EvictionPolicyLRU.
+	EvictionPolicy EvictionPolicy
+	// Weigher, if not nil, computes the weight (i.e. cost, such as approximate memory size) of a value,
+	// and the cache evicts values (as chosen by EvictionPolicy) to keep the total weight of all the values within
+	// MaxWeight, in addition to the Capacity limit. The weight of a value is computed once when it's
+	// stored into the cache. Weigher must return a non-negative weight.
+	Weigher func(key K, val V) int
+	// MaxWeight is the max total weight of all the values in the cache. Must be > 0 if Weigher is
+	// specified; ignored otherwise.
+	MaxWeight int64
+	// ExpireAfterWrite, if > 0, makes an entry expire once the duration has elapsed since the entry
+	// was loaded (or last refreshed). An expired entry is treated as a cache miss.
+	ExpireAfterWrite time.Duration
+	// ExpireAfterAccess, if > 0, makes an entry expire once the duration has elapsed since the entry
+	// was last loaded or read by Get.
+	ExpireAfterAccess time.Duration
+	// RefreshAfterWrite, if > 0, makes Get, upon hitting an entry older than the duration, kick off a
+	// reload of the entry in the background using the load function passed into that Get, while
+	// returning the current value right away. If the reload fails, the current value is kept.
+	RefreshAfterWrite time.Duration
+	// LoadTimeout, if > 0, bounds the time a load function passed into GetContext can take: the context
+	// the load function receives is cancelled once the duration has elapsed. A load function not taking
+	// a context can't be bounded.
+	LoadTimeout time.Duration
+	// ErrorExpireAfterWrite, if > 0, enables negative caching: an error returned by the load function
+	// is cached and returned by Get for the key, without calling the load function again, until the
+	// duration has elapsed.
+	ErrorExpireAfterWrite time.Duration
+	// ErrorMaxHits, if > 0, enables negative caching: an error returned by the load function is cached
+	// and returned by Get for the key at most ErrorMaxHits times before the load function is retried.
+	// If both ErrorExpireAfterWrite and ErrorMaxHits are set, a cached error is dropped upon whichever
+	// limit is reached first.
+	ErrorMaxHits int
+	// ErrorCapacity is the max number of cached errors when negative caching is enabled. Cached errors
+	// are kept separately from the cached values so failing keys never push valid values out of the
+	// cache. nil means a reasonable default capacity is used; 0 means no limit.
+	ErrorCapacity *int
+	// OnEviction, if not nil, is called for each value removed from the cache, with the reason of the
+	// removal. It's called synchronously, after the cache's internal lock is released, on the goroutine
+	// whose operation caused the removal, so it's safe for OnEviction to call back into the cache, but
+	// it should return quickly.
+	OnEviction func(key K, val V, reason EvictionReason)
+	// Shards is the number of independently locked segments the cache is partitioned into. 0 or 1
+	// means a single segment. With multiple shards, Capacity, MaxWeight and ErrorCapacity are evenly
+	// divided among the shards and eviction happens per shard, so the cache as a whole only
+	// approximately follows the EvictionPolicy.
+	Shards int
+	// Hasher hashes a key, for mapping it to its shard when Shards > 1, and for estimating its access
+	// frequency under EvictionPolicyWTinyLFU. nil means a default hasher is used, which is efficient for
+	// string, integer and bool keys (including such keys stored in interface{}); for keys of other types,
+	// it falls back to hashing the "%#v" formatting of the key, which is slow, so a custom Hasher is
+	// recommended for them.
+	Hasher func(key K) uint64
+	// DiskStore, if not nil, backs the cache with an on-disk second level: values evicted from the memory
+	// due to Capacity or MaxWeight are moved to disk, and upon a miss in the memory, the value is looked
+	// up on disk (and moved back into the memory if found) before calling the load function. Entries on
+	// disk survive process restarts (see FlushToDisk), and are subject to ExpireAfterWrite. Failing to
+	// set up DiskStore.Dir causes NewTypedLoadingCacheEx to panic.
+	DiskStore *DiskStoreOptions[K, V]
+	// Clock drives all the expiration and refresh decisions. nil means the OS clock is used. Tests
+	// can supply a mock clock to exercise expiration deterministically.
+	Clock Clock
+}
+
+// LoadingCacheOptions customizes a LoadingCache created by NewLoadingCacheEx.
+type LoadingCacheOptions = TypedLoadingCacheOptions[interface{}, interface{}]
+
+const (
+	defaultCapacity      = 65536
+	defaultErrorCapacity = 1024
+)
+
+func resolveCapacity(capacity ...int) int {
+	return resolveCapacityWithDefault(defaultCapacity, capacity...)
+}
+
+func resolveCapacityWithDefault(capv int, capacity ...int) int {
+	if len(capacity) > 0 {
+		if capacity[0] < 0 {
+			panic(fmt.Errorf("capacity must be >= 0, instead got: %d", capacity[0]))
+		}
+		capv = capacity[0]
+	}
+	if capv == 0 {
+		capv = maths.MaxIntValue - 1
+	}
+	return capv
+}
+
+func optionalCapacity(capacity ...int) *int {
+	if len(capacity) == 0 {
+		return nil
+	}
+	return &capacity[0]
+}
+
+func optionalInt(p *int) []int {
+	if p == nil {
+		return nil
+	}
+	return []int{*p}
+}
+
+func validateDuration(name string, d time.Duration) {
+	if d < 0 {
+		panic(fmt.Errorf("%s must be >= 0, instead got: %s", name, d))
+	}
+}
+
+// NewTypedLoadingCache creates a new TypedLoadingCache.
+func NewTypedLoadingCache[K comparable, V any](capacity ...int) *TypedLoadingCache[K, V] {
+	return NewTypedLoadingCacheEx(TypedLoadingCacheOptions[K, V]{Capacity: optionalCapacity(capacity...)})
+}
+
+// NewTypedLoadingCacheEx creates a new TypedLoadingCache with the given options.
+func NewTypedLoadingCacheEx[K comparable, V any](opts TypedLoadingCacheOptions[K, V]) *TypedLoadingCache[K, V] {
+	if opts.Weigher != nil && opts.MaxWeight <= 0 {
+		panic(fmt.Errorf("MaxWeight must be > 0 when Weigher is specified, instead got: %d", opts.MaxWeight))
+	}
+	if opts.ErrorMaxHits < 0 {
+		panic(fmt.Errorf("ErrorMaxHits must be >= 0, instead got: %d", opts.ErrorMaxHits))
+	}
+	if opts.EvictionPolicy < EvictionPolicyLRU || opts.EvictionPolicy > EvictionPolicyWTinyLFU {
+		panic(fmt.Errorf("unknown EvictionPolicy: %d", int(opts.EvictionPolicy)))
+	}
+	if opts.Shards < 0 {
+		panic(fmt.Errorf("Shards must be >= 0, instead got: %d", opts.Shards))
+	}
+	validateDuration("ExpireAfterWrite", opts.ExpireAfterWrite)
+	validateDuration("ExpireAfterAccess", opts.ExpireAfterAccess)
+	validateDuration("RefreshAfterWrite", opts.RefreshAfterWrite)
+	validateDuration("LoadTimeout", opts.LoadTimeout)
+	validateDuration("ErrorExpireAfterWrite", opts.ErrorExpireAfterWrite)
+	c := &TypedLoadingCache[K, V]{
+		capacity: resolveCapacity(optionalInt(opts.Capacity)...),
+		clock:    opts.Clock,
+		hasher:   opts.Hasher,
+	}
+	if c.clock == nil {
+		c.clock = osClock{}
+	}
+	if c.hasher == nil {
+		c.hasher = defaultHasher[K]
+	}
+	errCapacity := resolveCapacityWithDefault(defaultErrorCapacity, optionalInt(opts.ErrorCapacity)...)
+	shards := maths.MaxInt(1, opts.Shards)
+	c.segments = make([]*segment[K, V], shards)
+	for i := range c.segments {
+		c.segments[i] = newSegment(
+			opts, c.clock, c.hasher, shareOf(c.capacity, shards), shareOf(errCapacity, shards),
+			int64(shareOf(int(opts.MaxWeight), shards)))
+	}
+	if opts.DiskStore != nil {
+		disk, err := newDiskStore(*opts.DiskStore)
+		if err != nil {
+			panic(err)
+		}
+		c.disk = disk
+		for _, s := range c.segments {
+			s.disk = disk
+		}
+	}
+	return c
+}
+
+// shareOf returns the per-shard share of a cache limit, rounded up.
+func shareOf(limit, shards int) int {
+	if limit == maths.MaxIntValue-1 {
+		// no limit stays no limit.
+		return limit
+	}
+	return (limit + shards - 1) / shards
+}
+
+// TypedLoadFunc is the type of the loading function for TypedLoadingCache.
+type TypedLoadFunc[K comparable, V any] func(key K) (V, error)
+
+func (c *TypedLoadingCache[K, V]) segmentOf(key K) *segment[K, V] {
+	if len(c.segments) == 1 {
+		return c.segments[0]
+	}
+	return c.segments[c.hasher(key)%uint64(len(c.segments))]
+}
+
+// Get tries to fetch the value for a key from the cache; if not found (or expired), it will call
+// the load function to create the value for the key, store it into the cache and return
+// the value. If there is already a load in flight for the same key, Get waits for it and
+// returns its outcome instead of calling the load function again: all the waiters get the
+// same value or error, and if the load function panics, the panic is re-raised in all the
+// waiters. If negative caching is enabled, a cached load error of the key is returned as is.
+func (c *TypedLoadingCache[K, V]) Get(key K, load TypedLoadFunc[K, V]) (V, error) {
+	return c.segmentOf(key).get(key, loader[K, V]{load: load})
+}
+
+// Put stores the value for the key into the cache, replacing the current value (or the negatively
+// cached load error) of the key, if any. If there is a load in flight for the key, the loaded value
+// is still returned to its callers, but isn't stored into the cache, so it won't override the put value.
+func (c *TypedLoadingCache[K, V]) Put(key K, val V) {
+	c.segmentOf(key).put(key, val)
+	if c.disk != nil {
+		c.disk.remove(key)
+	}
+}
+
+// Peek returns the value of the key if it's in the cache and not expired. Unlike Get, Peek never
+// loads (nor looks at the on-disk second level), and has no effect on the cache: it updates neither
+// the recency (or frequency) of the entry nor the cache statistics.
+func (c *TypedLoadingCache[K, V]) Peek(key K) (V, bool) {
+	return c.segmentOf(key).peek(key)
+}
+
+// Invalidate removes the value, or the negatively cached load error, of the key from the cache. If
+// there is a load in flight for the key, its outcome is still returned to its callers, but isn't
+// stored into the cache.
+func (c *TypedLoadingCache[K, V]) Invalidate(key K) {
+	c.segmentOf(key).invalidate(key)
+	if c.disk != nil {
+		c.disk.remove(key)
+	}
+}
+
+// InvalidateAll removes all the values and negatively cached load errors from the cache. Similar to
+// Invalidate, the outcomes of the loads in flight won't be stored into the cache. For a sharded cache,
+// the shards are cleared one after another, not atomically as a whole.
+func (c *TypedLoadingCache[K, V]) InvalidateAll() {
+	for _, s := range c.segments {
+		s.invalidateAll()
+	}
+	if c.disk != nil {
+		c.disk.clear()
+	}
+}
+
+// InvalidateIf removes all the values for which pred returns true from the cache. pred is called with
+// the cache's internal lock held, so it must not call back into the cache and should return quickly.
+// With a DiskStore, pred is called for the values on disk as well, which requires decoding all of them.
+func (c *TypedLoadingCache[K, V]) InvalidateIf(pred func(key K, val V) bool) {
+	for _, s := range c.segments {
+		s.invalidateIf(pred)
+	}
+	if c.disk != nil {
+		c.disk.removeIf(pred)
+	}
+}
+
+// Len returns the number of values in the cache, including the expired ones that haven't been
+// removed yet, but excluding the ones on disk.
+func (c *TypedLoadingCache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.segments {
+		n += s.len()
+	}
+	return n
+}
+
+// FlushToDisk writes all the unexpired values in the memory to the on-disk second level (while keeping
+// them in the memory as well), so they survive a process restart. Usually called upon shutdown. No-op
+// if no DiskStore is used.
+func (c *TypedLoadingCache[K, V]) FlushToDisk() {
+	if c.disk == nil {
+		return
+	}
+	for _, s := range c.segments {
+		for _, e := range s.snapshot() {
+			s.putToDisk(e)
+		}
+	}
+}
+
+// DumpForTest returns all the unexpired entries in the cache. Should really only be used in
+// tests as the function name suggests.
+func (c *TypedLoadingCache[K, V]) DumpForTest() map[K]V {
+	m := make(map[K]V)
+	for _, s := range c.segments {
+		s.dump(m)
+	}
+	return m
+}
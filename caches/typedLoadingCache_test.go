@@ -0,0 +1,691 @@
+package caches
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antchfx/xpath"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/testlib"
+)
+
+type mockClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	reads int
+}
+
+func (c *mockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads++
+	return c.now
+}
+
+func (c *mockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newMockClock() *mockClock {
+	return &mockClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestNewTypedLoadingCacheEx(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		opts             TypedLoadingCacheOptions[string, int]
+		panicErr         string
+		expectedCapacity int
+	}{
+		{
+			name:             "default options",
+			opts:             TypedLoadingCacheOptions[string, int]{},
+			expectedCapacity: defaultCapacity,
+		},
+		{
+			name: "all options",
+			opts: TypedLoadingCacheOptions[string, int]{
+				Capacity:          testlib.IntPtr(10),
+				ExpireAfterWrite:  time.Minute,
+				ExpireAfterAccess: time.Second,
+				RefreshAfterWrite: time.Hour,
+				Clock:             newMockClock(),
+			},
+			expectedCapacity: 10,
+		},
+		{
+			name:     "invalid capacity",
+			opts:     TypedLoadingCacheOptions[string, int]{Capacity: testlib.IntPtr(-1)},
+			panicErr: "capacity must be >= 0, instead got: -1",
+		},
+		{
+			name: "Weigher without MaxWeight",
+			opts: TypedLoadingCacheOptions[string, int]{
+				Weigher: func(key string, val int) int { return val },
+			},
+			panicErr: "MaxWeight must be > 0 when Weigher is specified, instead got: 0",
+		},
+		{
+			name:     "invalid ExpireAfterWrite",
+			opts:     TypedLoadingCacheOptions[string, int]{ExpireAfterWrite: -time.Second},
+			panicErr: "ExpireAfterWrite must be >= 0, instead got: -1s",
+		},
+		{
+			name:     "invalid ExpireAfterAccess",
+			opts:     TypedLoadingCacheOptions[string, int]{ExpireAfterAccess: -time.Second},
+			panicErr: "ExpireAfterAccess must be >= 0, instead got: -1s",
+		},
+		{
+			name:     "invalid ErrorExpireAfterWrite",
+			opts:     TypedLoadingCacheOptions[string, int]{ErrorExpireAfterWrite: -time.Second},
+			panicErr: "ErrorExpireAfterWrite must be >= 0, instead got: -1s",
+		},
+		{
+			name:     "invalid ErrorMaxHits",
+			opts:     TypedLoadingCacheOptions[string, int]{ErrorMaxHits: -1},
+			panicErr: "ErrorMaxHits must be >= 0, instead got: -1",
+		},
+		{
+			name:     "invalid ErrorCapacity",
+			opts:     TypedLoadingCacheOptions[string, int]{ErrorCapacity: testlib.IntPtr(-2)},
+			panicErr: "capacity must be >= 0, instead got: -2",
+		},
+		{
+			name:     "invalid RefreshAfterWrite",
+			opts:     TypedLoadingCacheOptions[string, int]{RefreshAfterWrite: -time.Second},
+			panicErr: "RefreshAfterWrite must be >= 0, instead got: -1s",
+		},
+		{
+			name:     "invalid LoadTimeout",
+			opts:     TypedLoadingCacheOptions[string, int]{LoadTimeout: -time.Second},
+			panicErr: "LoadTimeout must be >= 0, instead got: -1s",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.panicErr == "" {
+				c := NewTypedLoadingCacheEx(test.opts)
+				assert.NotNil(t, c)
+				assert.Equal(t, test.expectedCapacity, c.capacity)
+				assert.NotNil(t, c.clock)
+			} else {
+				assert.PanicsWithError(t, test.panicErr, func() {
+					NewTypedLoadingCacheEx(test.opts)
+				})
+			}
+		})
+	}
+}
+
+func TestTypedLoadingCache_Get(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		cache         *TypedLoadingCache[string, int]
+		key           string
+		load          TypedLoadFunc[string, int]
+		expectedError error
+		expectedVal   int
+		expectedCache map[string]int
+	}{
+		{
+			name:          "cache hit",
+			cache:         NewTypedLoadingCache[string, int](),
+			key:           "2",
+			load:          nil,
+			expectedError: nil,
+			expectedVal:   2,
+			expectedCache: map[string]int{"1": 1, "2": 2},
+		},
+		{
+			name:  "cache miss, loading error",
+			cache: NewTypedLoadingCache[string, int](),
+			key:   "3",
+			load: func(key string) (int, error) {
+				return 0, errors.New("test error")
+			},
+			expectedError: errors.New("test error"),
+			expectedVal:   0,
+			expectedCache: map[string]int{"1": 1, "2": 2},
+		},
+		{
+			name:  "cache miss, loading okay, no eviction",
+			cache: NewTypedLoadingCache[string, int](),
+			key:   "3",
+			load: func(key string) (int, error) {
+				return strconv.Atoi(key)
+			},
+			expectedError: nil,
+			expectedVal:   3,
+			expectedCache: map[string]int{"1": 1, "2": 2, "3": 3},
+		},
+		{
+			name:  "cache miss, loading okay, eviction",
+			cache: NewTypedLoadingCache[string, int](2),
+			key:   "3",
+			load: func(key string) (int, error) {
+				return strconv.Atoi(key)
+			},
+			expectedError: nil,
+			expectedVal:   3,
+			expectedCache: map[string]int{"2": 2, "3": 3},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.cache.Put("1", 1)
+			test.cache.Put("2", 2)
+			val, err := test.cache.Get(test.key, test.load)
+			if test.expectedError != nil {
+				assert.Error(t, err)
+				assert.Equal(t, test.expectedError.Error(), err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedVal, val)
+			assert.Equal(t, test.expectedCache, test.cache.DumpForTest())
+		})
+	}
+}
+
+func TestTypedLoadingCache_LRUOrder(t *testing.T) {
+	c := NewTypedLoadingCache[int, string](3)
+	c.Put(1, "one")
+	c.Put(2, "two")
+	c.Put(3, "three")
+	// touch 1 so that 2 becomes the least recently used.
+	v, err := c.Get(1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "one", v)
+	// re-adding an existing key updates the value and doesn't grow the cache.
+	c.Put(3, "THREE")
+	assert.Equal(t, map[int]string{1: "one", 2: "two", 3: "THREE"}, c.DumpForTest())
+	c.Put(4, "four")
+	assert.Equal(t, map[int]string{1: "one", 3: "THREE", 4: "four"}, c.DumpForTest())
+	c.Put(5, "five")
+	assert.Equal(t, map[int]string{3: "THREE", 4: "four", 5: "five"}, c.DumpForTest())
+}
+
+func TestTypedLoadingCache_PutAndPeek(t *testing.T) {
+	clock := newMockClock()
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		Capacity:         testlib.IntPtr(2),
+		ExpireAfterWrite: time.Minute,
+		ErrorMaxHits:     10,
+		Clock:            clock,
+	})
+	v, found := c.Peek("a")
+	assert.False(t, found)
+	assert.Equal(t, 0, v)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	assert.Equal(t, 2, c.Len())
+	// peek doesn't touch the entry: a stays the lru entry and gets evicted by c.
+	v, found = c.Peek("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	c.Put("c", 3)
+	_, found = c.Peek("a")
+	assert.False(t, found)
+	assert.Equal(t, 2, c.Len())
+	// peek doesn't load or count in the stats.
+	assert.Equal(t, LoadingCacheStats{Evictions: 1, Size: 2}, c.Stats())
+
+	// put replaces a negatively cached error.
+	_, err := c.Get("d", func(string) (int, error) { return 0, errors.New("bad") })
+	assert.EqualError(t, err, "bad")
+	c.Put("d", 4)
+	v, err = c.Get("d", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, v)
+
+	// peek honors expiration.
+	clock.Advance(time.Minute)
+	_, found = c.Peek("d")
+	assert.False(t, found)
+}
+
+func TestTypedLoadingCache_Invalidate(t *testing.T) {
+	var evictions []evictionForTest
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[int, int]{
+		ErrorMaxHits: 10,
+		Shards:       4,
+		OnEviction: func(key int, val int, reason EvictionReason) {
+			evictions = append(evictions, evictionForTest{strconv.Itoa(key), val, reason})
+		},
+	})
+	load := func(key int) (int, error) {
+		if key < 0 {
+			return 0, errors.New("negative")
+		}
+		return key * 10, nil
+	}
+	for i := 0; i < 10; i++ {
+		_, _ = c.Get(i, load)
+	}
+	_, _ = c.Get(-1, load)
+	assert.Equal(t, 10, c.Len())
+
+	c.Invalidate(3)
+	c.Invalidate(100) // no-op
+	assert.Equal(t, 9, c.Len())
+	assert.Equal(t, []evictionForTest{{"3", 30, EvictionReasonExplicit}}, evictions)
+
+	c.InvalidateIf(func(key int, val int) bool { return key%2 == 0 })
+	assert.Equal(t, map[int]int{1: 10, 5: 50, 7: 70, 9: 90}, c.DumpForTest())
+	assert.Equal(t, 6, len(evictions))
+
+	// the cached error is invalidated, so the next Get loads again.
+	c.Invalidate(-1)
+	_, err := c.Get(-1, func(int) (int, error) { return -10, nil })
+	assert.NoError(t, err)
+
+	c.InvalidateAll()
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, 11, len(evictions))
+	for _, e := range evictions {
+		assert.Equal(t, EvictionReasonExplicit, e.reason)
+	}
+	// explicit removals don't count as evictions.
+	assert.Equal(t, int64(0), c.Stats().Evictions)
+}
+
+func TestTypedLoadingCache_Invalidate_InFlightLoadNotCached(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		op       func(c *TypedLoadingCache[string, int])
+		expected map[string]int
+	}{
+		{
+			name:     "Invalidate",
+			op:       func(c *TypedLoadingCache[string, int]) { c.Invalidate("key") },
+			expected: map[string]int{},
+		},
+		{
+			name:     "InvalidateAll",
+			op:       func(c *TypedLoadingCache[string, int]) { c.InvalidateAll() },
+			expected: map[string]int{},
+		},
+		{
+			name:     "Put",
+			op:       func(c *TypedLoadingCache[string, int]) { c.Put("key", 2) },
+			expected: map[string]int{"key": 2},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewTypedLoadingCache[string, int]()
+			loading := make(chan struct{})
+			release := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				v, err := c.Get("key", func(string) (int, error) {
+					close(loading)
+					<-release
+					return 1, nil
+				})
+				// the caller still gets the loaded value.
+				assert.NoError(t, err)
+				assert.Equal(t, 1, v)
+			}()
+			<-loading
+			test.op(c)
+			close(release)
+			<-done
+			assert.Equal(t, test.expected, c.DumpForTest())
+		})
+	}
+}
+
+func TestTypedLoadingCache_NoTypeAssertionNeeded(t *testing.T) {
+	c := NewTypedLoadingCache[string, *regexp.Regexp]()
+	r, err := c.Get("^a+$", regexp.Compile)
+	assert.NoError(t, err)
+	assert.True(t, r.MatchString("aaa"))
+	r, err = c.Get("[", regexp.Compile)
+	assert.Error(t, err)
+	assert.Nil(t, r)
+}
+
+// waitForMisses blocks until the cache has the given number of misses, e.g. until all the Get callers
+// of a key being loaded pile up on the in-flight load: a caller counts as a miss once it's waiting on it.
+func waitForMisses[K comparable, V any](c *TypedLoadingCache[K, V], misses int64) {
+	for c.Stats().Misses < misses {
+		runtime.Gosched()
+	}
+}
+
+func TestTypedLoadingCache_Get_ConcurrentMissesShareSingleLoad(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		loadVal     int
+		loadErr     error
+		expectedErr string
+		expectedLen int
+	}{
+		{
+			name:        "load success",
+			loadVal:     42,
+			expectedLen: 1,
+		},
+		{
+			name:        "load failure",
+			loadErr:     errors.New("test error"),
+			expectedErr: "test error",
+			expectedLen: 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			const waiters = 200
+			c := NewTypedLoadingCache[string, int]()
+			var loads int32
+			release := make(chan struct{})
+			load := func(key string) (int, error) {
+				atomic.AddInt32(&loads, 1)
+				<-release
+				return test.loadVal, test.loadErr
+			}
+			var wg sync.WaitGroup
+			vals := make([]int, waiters)
+			errs := make([]error, waiters)
+			for i := 0; i < waiters; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					vals[i], errs[i] = c.Get("key", load)
+				}(i)
+			}
+			waitForMisses(c, waiters)
+			close(release)
+			wg.Wait()
+			assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+			for i := 0; i < waiters; i++ {
+				if test.expectedErr != "" {
+					assert.Error(t, errs[i])
+					assert.Equal(t, test.expectedErr, errs[i].Error())
+				} else {
+					assert.NoError(t, errs[i])
+				}
+				assert.Equal(t, test.loadVal, vals[i])
+			}
+			assert.Equal(t, test.expectedLen, len(c.DumpForTest()))
+			assert.Equal(t, 0, len(c.segments[0].calls))
+		})
+	}
+}
+
+func TestTypedLoadingCache_Get_LoadPanicReachesAllWaiters(t *testing.T) {
+	const waiters = 10
+	c := NewTypedLoadingCache[string, int]()
+	var loads int32
+	release := make(chan struct{})
+	load := func(key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		panic("boom")
+	}
+	var wg sync.WaitGroup
+	panics := make([]interface{}, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { panics[i] = recover() }()
+			_, _ = c.Get("key", load)
+		}(i)
+	}
+	waitForMisses(c, waiters)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	for i := 0; i < waiters; i++ {
+		assert.Equal(t, "boom", panics[i])
+	}
+	assert.Equal(t, 0, len(c.DumpForTest()))
+	assert.Equal(t, 0, len(c.segments[0].calls))
+	// the cache must remain usable after a panicking load.
+	v, err := c.Get("key", func(key string) (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestTypedLoadingCache_ExpireAfterWrite(t *testing.T) {
+	clock := newMockClock()
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		ExpireAfterWrite: time.Minute,
+		Clock:            clock,
+	})
+	loads := 0
+	load := func(key string) (int, error) {
+		loads++
+		return loads, nil
+	}
+	v, err := c.Get("key", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	// reads don't extend the life of an entry under ExpireAfterWrite.
+	clock.Advance(59 * time.Second)
+	v, err = c.Get("key", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	clock.Advance(time.Second)
+	assert.Equal(t, map[string]int{}, c.DumpForTest())
+	v, err = c.Get("key", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, map[string]int{"key": 2}, c.DumpForTest())
+}
+
+func TestTypedLoadingCache_ExpireAfterAccess(t *testing.T) {
+	clock := newMockClock()
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		ExpireAfterAccess: time.Minute,
+		Clock:             clock,
+	})
+	loads := 0
+	load := func(key string) (int, error) {
+		loads++
+		return loads, nil
+	}
+	v, err := c.Get("key", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	// each read extends the life of an entry under ExpireAfterAccess.
+	for i := 0; i < 5; i++ {
+		clock.Advance(59 * time.Second)
+		v, err = c.Get("key", load)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v)
+	}
+	clock.Advance(time.Minute)
+	v, err = c.Get("key", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+}
+
+func TestTypedLoadingCache_RefreshAfterWrite(t *testing.T) {
+	clock := newMockClock()
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, string]{
+		RefreshAfterWrite: time.Minute,
+		Clock:             clock,
+	})
+	v, err := c.Get("key", func(key string) (string, error) { return "v1", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	// not yet due for refresh.
+	clock.Advance(30 * time.Second)
+	v, err = c.Get("key", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	// due for refresh: old value served while the reload is in flight; a second Get doesn't
+	// start another reload.
+	clock.Advance(30 * time.Second)
+	reloading := make(chan struct{})
+	release := make(chan struct{})
+	v, err = c.Get("key", func(key string) (string, error) {
+		close(reloading)
+		<-release
+		return "v2", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+	<-reloading
+	v, err = c.Get("key", func(key string) (string, error) {
+		panic("must not be called")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v)
+	close(release)
+	waitForNoCalls(c)
+	assert.Equal(t, map[string]string{"key": "v2"}, c.DumpForTest())
+
+	// failed reload keeps the current value.
+	clock.Advance(time.Minute)
+	v, err = c.Get("key", func(key string) (string, error) { return "", errors.New("test error") })
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", v)
+	waitForNoCalls(c)
+	assert.Equal(t, map[string]string{"key": "v2"}, c.DumpForTest())
+
+	// panicking reload doesn't crash the process and keeps the current value.
+	v, err = c.Get("key", func(key string) (string, error) { panic("boom") })
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", v)
+	waitForNoCalls(c)
+	assert.Equal(t, map[string]string{"key": "v2"}, c.DumpForTest())
+}
+
+func TestTypedLoadingCache_NegativeCaching(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts TypedLoadingCacheOptions[string, int]
+		// advance is the clock advance before each Get.
+		advance time.Duration
+		// expectedLoads is the accumulated number of loads after each Get.
+		expectedLoads []int
+	}{
+		{
+			name:          "disabled",
+			opts:          TypedLoadingCacheOptions[string, int]{},
+			expectedLoads: []int{1, 2, 3, 4},
+		},
+		{
+			name:          "expire after write",
+			opts:          TypedLoadingCacheOptions[string, int]{ErrorExpireAfterWrite: time.Minute},
+			advance:       25 * time.Second,
+			expectedLoads: []int{1, 1, 1, 2, 2, 2, 3},
+		},
+		{
+			name:          "max hits",
+			opts:          TypedLoadingCacheOptions[string, int]{ErrorMaxHits: 2},
+			advance:       time.Hour,
+			expectedLoads: []int{1, 1, 1, 2, 2, 2, 3},
+		},
+		{
+			name: "expire after write reached before max hits",
+			opts: TypedLoadingCacheOptions[string, int]{
+				ErrorExpireAfterWrite: time.Minute,
+				ErrorMaxHits:          5,
+			},
+			advance:       30 * time.Second,
+			expectedLoads: []int{1, 1, 2, 2, 3},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newMockClock()
+			test.opts.Clock = clock
+			c := NewTypedLoadingCacheEx(test.opts)
+			loads := 0
+			load := func(key string) (int, error) {
+				loads++
+				return 0, errors.New("bad key " + key)
+			}
+			for i, expectedLoads := range test.expectedLoads {
+				if i > 0 {
+					clock.Advance(test.advance)
+				}
+				_, err := c.Get("key", load)
+				assert.Error(t, err)
+				assert.Equal(t, "bad key key", err.Error())
+				assert.Equal(t, expectedLoads, loads, "Get #%d", i)
+			}
+			assert.Equal(t, map[string]int{}, c.DumpForTest())
+		})
+	}
+}
+
+func TestTypedLoadingCache_NegativeCaching_SeparateCapacity(t *testing.T) {
+	c := NewTypedLoadingCacheEx(TypedLoadingCacheOptions[string, int]{
+		Capacity:      testlib.IntPtr(2),
+		ErrorMaxHits:  10,
+		ErrorCapacity: testlib.IntPtr(1),
+	})
+	load := func(key string) (int, error) {
+		if key[0] == 'e' {
+			return 0, errors.New(key)
+		}
+		return strconv.Atoi(key)
+	}
+	for _, key := range []string{"1", "2", "e1", "e2", "e3"} {
+		_, _ = c.Get(key, load)
+	}
+	// failing keys never push valid values out.
+	assert.Equal(t, map[string]int{"1": 1, "2": 2}, c.DumpForTest())
+	assert.Equal(t, []string{"e3"}, lruStoreKeysForTest(c.segments[0].errs))
+
+	// a successful load of a key with a cached error drops the cached error.
+	c.segments[0].errs.add("3", errors.New("stale"), c.clock.Now())
+	c.Put("3", 3)
+	assert.Equal(t, map[string]int{"2": 2, "3": 3}, c.DumpForTest())
+	_, found := c.segments[0].errs.get("3")
+	assert.False(t, found)
+}
+
+// waitForNoCalls blocks until there is no more load in flight in the cache.
+func waitForNoCalls[K comparable, V any](c *TypedLoadingCache[K, V]) {
+	for {
+		c.segments[0].mu.Lock()
+		n := len(c.segments[0].calls)
+		c.segments[0].mu.Unlock()
+		if n == 0 {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func BenchmarkTypedLoadingCache_NoCapacityLimit(b *testing.B) {
+	rand.Seed(benchRandSeed)
+	cache := NewTypedLoadingCache[string, *xpath.Expr]()
+	for i := 0; i < b.N; i++ {
+		_, err := cache.Get(getBenchKey(), xpath.Compile)
+		assert.NoError(b, err)
+	}
+}
+
+func BenchmarkTypedLoadingCache_SmallCapacityLimit(b *testing.B) {
+	rand.Seed(benchRandSeed)
+	cache := NewTypedLoadingCache[string, *xpath.Expr](benchKeySize / 100)
+	for i := 0; i < b.N; i++ {
+		_, err := cache.Get(getBenchKey(), xpath.Compile)
+		assert.NoError(b, err)
+	}
+}
+
+func BenchmarkTypedLoadingCache_LargeCapacityLimit(b *testing.B) {
+	rand.Seed(benchRandSeed)
+	cache := NewTypedLoadingCache[string, *xpath.Expr](benchKeySize / 2)
+	for i := 0; i < b.N; i++ {
+		_, err := cache.Get(getBenchKey(), xpath.Compile)
+		assert.NoError(b, err)
+	}
+}
@@ -0,0 +1,109 @@
+package caches
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var embeddedTZData struct {
+	mu      sync.RWMutex
+	version string
+	load    func(name string) ([]byte, bool)
+}
+
+// RegisterTZData registers an embedded IANA tz database, which GetTimeLocation falls back to when
+// the system one (see time.LoadLocation) doesn't know a time zone, e.g. in a minimal container with
+// no /usr/share/zoneinfo. load returns the TZif data of the given time zone, or false if unknown.
+// Usually called by importing the caches/tzdata package for side effect:
+//
+//	import _ "github.com/jf-tech/go-corelib/caches/tzdata"
+//
+// Note the locations already in the cache are not affected by the registration.
+func RegisterTZData(version string, load func(name string) ([]byte, bool)) {
+	embeddedTZData.mu.Lock()
+	defer embeddedTZData.mu.Unlock()
+	embeddedTZData.version = version
+	embeddedTZData.load = load
+}
+
+// loadLocation is time.LoadLocation, falling back to the embedded tz database, if any.
+func loadLocation(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err == nil {
+		return loc, nil
+	}
+	embeddedTZData.mu.RLock()
+	load := embeddedTZData.load
+	embeddedTZData.mu.RUnlock()
+	if load == nil {
+		return nil, err
+	}
+	data, found := load(name)
+	if !found {
+		return nil, err
+	}
+	return time.LoadLocationFromTZData(name, data)
+}
+
+// TZDataInfo tells which IANA tz databases GetTimeLocation uses.
+type TZDataInfo struct {
+	// SystemAvailable tells whether the system tz database (including the one of the Go
+	// toolchain or time/tzdata) is available.
+	SystemAvailable bool
+	// SystemVersion is the version (e.g. "2024a") of the system tz database, or "" if it isn't
+	// available or doesn't record its version.
+	SystemVersion string
+	// EmbeddedVersion is the version of the tz database registered by RegisterTZData, or "" if
+	// there isn't one.
+	EmbeddedVersion string
+}
+
+// Version returns the version of the tz database in use: the system one if available, the
+// embedded one otherwise. Returns "" if unknown.
+func (i TZDataInfo) Version() string {
+	if i.SystemAvailable {
+		return i.SystemVersion
+	}
+	return i.EmbeddedVersion
+}
+
+// TZData returns which IANA tz databases GetTimeLocation uses.
+func TZData() TZDataInfo {
+	embeddedTZData.mu.RLock()
+	defer embeddedTZData.mu.RUnlock()
+	info := TZDataInfo{EmbeddedVersion: embeddedTZData.version}
+	// UTC and Local never hit the tz database, so probe with a real time zone.
+	if _, err := time.LoadLocation("America/New_York"); err == nil {
+		info.SystemAvailable = true
+		info.SystemVersion = systemTZDataVersion()
+	}
+	return info
+}
+
+// zoneinfoDirs are the directories time.LoadLocation looks up on unix systems.
+var zoneinfoDirs = []string{"/usr/share/zoneinfo/", "/usr/share/lib/zoneinfo/", "/usr/lib/locale/TZ/"}
+
+// systemTZDataVersion reads the version from the first line (e.g. "# version 2024a") of the
+// tzdata.zi file of the system tz database.
+func systemTZDataVersion() string {
+	dirs := zoneinfoDirs
+	if dir := os.Getenv("ZONEINFO"); dir != "" {
+		dirs = append([]string{dir}, dirs...)
+	}
+	for _, dir := range dirs {
+		f, err := os.Open(filepath.Join(dir, "tzdata.zi"))
+		if err != nil {
+			continue
+		}
+		line, _ := bufio.NewReader(f).ReadString('\n')
+		_ = f.Close()
+		if v := strings.TrimPrefix(strings.TrimSpace(line), "# version "); v != strings.TrimSpace(line) {
+			return v
+		}
+	}
+	return ""
+}
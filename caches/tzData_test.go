@@ -0,0 +1,88 @@
+package caches
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func registerTZDataForTest(t *testing.T, version string, load func(name string) ([]byte, bool)) {
+	embeddedTZData.mu.RLock()
+	savedVersion, savedLoad := embeddedTZData.version, embeddedTZData.load
+	embeddedTZData.mu.RUnlock()
+	t.Cleanup(func() { RegisterTZData(savedVersion, savedLoad) })
+	RegisterTZData(version, load)
+}
+
+// fixedTZifForTest returns a version 1 TZif file of a fixed offset time zone with no transitions.
+func fixedTZifForTest(abbr string, offset int) []byte {
+	data := append([]byte("TZif"), make([]byte, 16)...)
+	// counts of isutc, isstd, leap, transition time, local time type and abbreviation chars.
+	for _, n := range []int{0, 0, 0, 0, 1, len(abbr) + 1} {
+		data = binary.BigEndian.AppendUint32(data, uint32(n))
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(offset))
+	data = append(data, 0, 0) // isdst, abbreviation index.
+	return append(append(data, abbr...), 0)
+}
+
+func TestGetTimeLocation_EmbeddedTZDataFallback(t *testing.T) {
+	TimeLocationCache = NewLoadingCache()
+	tzif := fixedTZifForTest("TEST", 3*3600)
+	var asked []string
+	registerTZDataForTest(t, "2099z", func(name string) ([]byte, bool) {
+		asked = append(asked, name)
+		if name == "Test/Zone" {
+			return tzif, true
+		}
+		return nil, false
+	})
+
+	loc, err := GetTimeLocation("Test/Zone")
+	assert.NoError(t, err)
+	assert.Equal(t, "Test/Zone", loc.String())
+	name, offset := time.Date(2021, time.July, 1, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, "TEST", name)
+	assert.Equal(t, 3*3600, offset)
+
+	// time zones known by the system don't hit the embedded tz database.
+	_, err = GetTimeLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// time zones unknown by either tz database keep failing with the system error.
+	_, err = GetTimeLocation("Nowhere/Zone")
+	assert.EqualError(t, err, "unknown time zone Nowhere/Zone")
+	assert.Equal(t, []string{"Test/Zone", "Nowhere/Zone"}, asked)
+
+	assert.Equal(t, "2099z", TZData().EmbeddedVersion)
+}
+
+func TestTZData(t *testing.T) {
+	registerTZDataForTest(t, "", nil)
+	info := TZData()
+	// the system tz database is always available in tests, from the Go toolchain at least.
+	assert.True(t, info.SystemAvailable)
+	assert.Equal(t, "", info.EmbeddedVersion)
+	assert.Equal(t, info.SystemVersion, info.Version())
+
+	registerTZDataForTest(t, "2099z", func(string) ([]byte, bool) { return nil, false })
+	assert.Equal(t, "2099z", TZDataInfo{EmbeddedVersion: "2099z"}.Version())
+	assert.Equal(t, "2024a", TZDataInfo{SystemAvailable: true, SystemVersion: "2024a", EmbeddedVersion: "2099z"}.Version())
+}
+
+func TestSystemTZDataVersion(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tzdata.zi"), []byte("# version 2023c\n# more\n"), 0644))
+	t.Setenv("ZONEINFO", dir)
+	assert.Equal(t, "2023c", systemTZDataVersion())
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tzdata.zi"), []byte("R 1 2 3\n"), 0644))
+	saved := zoneinfoDirs
+	defer func() { zoneinfoDirs = saved }()
+	zoneinfoDirs = nil
+	assert.Equal(t, "", systemTZDataVersion())
+}
@@ -0,0 +1,95 @@
+//go:build ignore
+
+// gen.go repacks the IANA tz database shipped with the Go toolchain ($GOROOT/lib/time/zoneinfo.zip,
+// which is stored uncompressed) into a compressed zoneinfo.zip, and records its version in zversion.go.
+// Run by `go generate` in this directory.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+)
+
+func main() {
+	src := filepath.Join(runtime.GOROOT(), "lib", "time")
+	version, err := readVersion(filepath.Join(src, "update.bash"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	r, err := zip.OpenReader(filepath.Join(src, "zoneinfo.zip"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	files := r.File
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestCompression)
+	})
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		data, err := readFile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// no modification time, so the output only changes when the tz database does.
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := fw.Write(data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("zoneinfo.zip", buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	code := fmt.Sprintf(`// Code generated by gen.go. DO NOT EDIT.
+
+package tzdata
+
+// Version is the version of the bundled IANA tz database.
+const Version = %q
+`, version)
+	if err := os.WriteFile("zversion.go", []byte(code), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readVersion(updateScript string) (string, error) {
+	script, err := os.ReadFile(updateScript)
+	if err != nil {
+		return "", err
+	}
+	m := regexp.MustCompile(`(?m)^DATA=(\S+)$`).FindSubmatch(script)
+	if m == nil {
+		return "", fmt.Errorf("tz database version not found in %s", updateScript)
+	}
+	return string(m[1]), nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,62 @@
+// Package tzdata bundles a compressed IANA tz database, which caches.GetTimeLocation (and so the
+// times package) falls back to when the system one is missing, e.g. in a minimal container with no
+// /usr/share/zoneinfo. Importing it for side effect adds about 270KB to the binary:
+//
+//	import _ "github.com/jf-tech/go-corelib/caches/tzdata"
+//
+// Unlike time/tzdata, it only affects caches.GetTimeLocation, not time.LoadLocation, and its version
+// can be queried by caches.TZData.
+package tzdata
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed" // for go:embed
+	"io"
+
+	"github.com/jf-tech/go-corelib/caches"
+)
+
+//go:generate go run gen.go
+
+//go:embed zoneinfo.zip
+var zoneinfoZip []byte
+
+func init() {
+	files, err := indexZip(zoneinfoZip)
+	if err != nil {
+		panic(err)
+	}
+	caches.RegisterTZData(Version, func(name string) ([]byte, bool) {
+		f, found := files[name]
+		if !found {
+			return nil, false
+		}
+		data, err := readFile(f)
+		if err != nil {
+			return nil, false
+		}
+		return data, true
+	})
+}
+
+func indexZip(data []byte) (map[string]*zip.File, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+	return files, nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,36 @@
+package tzdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/caches"
+)
+
+func TestZoneinfoZip(t *testing.T) {
+	files, err := indexZip(zoneinfoZip)
+	assert.NoError(t, err)
+	assert.True(t, len(files) > 500)
+	for _, name := range []string{"America/New_York", "Asia/Kolkata", "Europe/London", "Etc/GMT+5"} {
+		t.Run(name, func(t *testing.T) {
+			f, found := files[name]
+			assert.True(t, found)
+			data, err := readFile(f)
+			assert.NoError(t, err)
+			loc, err := time.LoadLocationFromTZData(name, data)
+			assert.NoError(t, err)
+			// the embedded time zone must agree with the system one.
+			sysLoc, err := time.LoadLocation(name)
+			assert.NoError(t, err)
+			at := time.Date(2021, time.July, 1, 12, 0, 0, 0, time.UTC)
+			assert.Equal(t, at.In(sysLoc).Format(time.RFC3339), at.In(loc).Format(time.RFC3339))
+		})
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	assert.Equal(t, Version, caches.TZData().EmbeddedVersion)
+	assert.Regexp(t, `^\d{4}[a-z]$`, Version)
+}
@@ -5,16 +5,21 @@ import (
 )
 
 // XPathExprCache is the default loading cache used for caching the compiled
-// xpath expression. If the default size is too big/small and/or a cache limit isn't
-// desired at all, caller can simply replace the cache during global initialization.
-// But be aware it's global so any packages uses this package inside your process will
-// be affected.
+// xpath expression, i.e. the XPathExprCacheName cache of DefaultCacheRegistry. Be aware
+// it's global so any packages uses this package inside your process will be affected by
+// replacing it; to customize the cache for your own use, create a CacheRegistry instead.
 var XPathExprCache = NewLoadingCache()
 
 // GetXPathExpr compiles a given xpath expression string and returns a compiled *xpath.Expr
-// or error.
+// or error, using DefaultCacheRegistry.
 func GetXPathExpr(expr string) (*xpath.Expr, error) {
-	exp, err := XPathExprCache.Get(expr, func(key interface{}) (interface{}, error) {
+	return defaultCacheRegistry.GetXPathExpr(expr)
+}
+
+// GetXPathExpr compiles a given xpath expression string and returns a compiled *xpath.Expr
+// or error, using the registry's XPathExprCacheName cache.
+func (r *CacheRegistry) GetXPathExpr(expr string) (*xpath.Expr, error) {
+	exp, err := r.Cache(XPathExprCacheName).Get(expr, func(key interface{}) (interface{}, error) {
 		return xpath.Compile(key.(string))
 	})
 	if err != nil {
@@ -26,3 +26,16 @@ func TestGetXPathExpr(t *testing.T) {
 	assert.NotNil(t, expr)
 	assert.Equal(t, 1, len(XPathExprCache.DumpForTest()))
 }
+
+func TestCacheRegistry_GetXPathExpr(t *testing.T) {
+	XPathExprCache = NewLoadingCache()
+	r := NewCacheRegistry()
+	expr, err := r.GetXPathExpr("/A/B")
+	assert.NoError(t, err)
+	assert.NotNil(t, expr)
+	_, err = r.GetXPathExpr(">")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(r.Cache(XPathExprCacheName).DumpForTest()))
+	// the registry is isolated from the default one.
+	assert.Equal(t, 0, len(XPathExprCache.DumpForTest()))
+}
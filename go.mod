@@ -1,11 +1,18 @@
 module github.com/jf-tech/go-corelib
 
-go 1.12
+// go 1.20 is the minimum: LoadingCache is TypedLoadingCache[interface{}, interface{}], which needs
+// interface{} to satisfy comparable, allowed since go 1.20.
+go 1.20
 
 require (
 	github.com/antchfx/xpath v1.1.10
 	github.com/bradleyjkemp/cupaloy v2.3.0+incompatible
-	github.com/hashicorp/golang-lru v0.5.4
 	github.com/stretchr/testify v1.6.1
 	github.com/tkuchiki/go-timezone v0.2.0
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
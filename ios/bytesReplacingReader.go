@@ -24,9 +24,26 @@ type BytesReplacer interface {
 	Index(buf []byte) (int, []byte, []byte)
 }
 
+// BytesReplacerEx is an optional extension of BytesReplacer, for replacers whose matches depend on
+// the bytes following them, e.g. the longest of multiple search tokens sharing a prefix. If the
+// BytesReplacer passed into BytesReplacingReader implements BytesReplacerEx, IndexEx is used instead
+// of Index.
+type BytesReplacerEx interface {
+	BytesReplacer
+	// IndexEx does token search for BytesReplacingReader, same as Index, except:
+	// - atEOF tells whether buf holds all the remaining input. If not, IndexEx must not return a
+	//   match that could turn out differently given more input; it returns -1 instead, and will be
+	//   called again once more input is read in (or the end of the input is reached). Such a match
+	//   must start within the last (max search token len - 1) bytes of buf.
+	// - a non-nil error stops the replacement: BytesReplacingReader returns it after the bytes before
+	//   the returned index (or before buf, if the index is negative), dropping the rest.
+	IndexEx(buf []byte, atEOF bool) (int, []byte, []byte, error)
+}
+
 // BytesReplacingReader allows transparent replacement of a given token during read operation.
 type BytesReplacingReader struct {
 	replacer          BytesReplacer
+	replacerEx        BytesReplacerEx
 	maxSearchTokenLen int
 	r                 io.Reader
 	err               error
@@ -35,6 +52,45 @@ type BytesReplacingReader struct {
 	buf0, buf1 int
 	// because we need to replace 'search' with 'replace', this marks the max bytes we can read into buf
 	max int
+	// output: bytes returned by Read so far; delta: output len - input len of the replacements so far.
+	output, delta int64
+	count         int64
+	// perSearch is only kept if enabled by EnablePerSearchTokenStats.
+	perSearchEnabled bool
+	perSearch        map[string]*searchCount
+	// most often the same search token is replaced again, so the last one is checked first.
+	last       *searchCount
+	statsKeyer searchStatsKeyer
+	observer   func(Replacement)
+	// nil, unless enabled by EnableOffsetMap.
+	offsets *offsetMap
+}
+
+// Replacement describes a replacement done by a BytesReplacingReader, for its observer.
+type Replacement struct {
+	// InputOffset is the offset of the search token in the input stream.
+	InputOffset int64
+	// OutputOffset is the offset of the replace token in the output stream.
+	OutputOffset int64
+	// Search is the search token found, and Replace the replace token it's replaced with. Both are
+	// only valid during the observer call.
+	Search, Replace []byte
+}
+
+// ReplacingStats is the statistics of the replacements done by a BytesReplacingReader.
+type ReplacingStats struct {
+	// Replacements is the total number of replacements.
+	Replacements int64
+	// PerSearchToken is the number of replacements per search token; nil unless enabled by
+	// EnablePerSearchTokenStats. For a RegexReplacer, all the matches are counted under the regex
+	// pattern, never under the matched texts.
+	PerSearchToken map[string]int64
+}
+
+// searchStatsKeyer is implemented by the BytesReplacers whose search tokens are unbounded, e.g. the
+// matches of a regex, to count the replacements under a fixed key instead, for ReplacingStats.
+type searchStatsKeyer interface {
+	searchStatsKey(search []byte) []byte
 }
 
 const defaultBufSize = int(4096)
@@ -51,20 +107,38 @@ func (r *BytesReplacingReader) ResetEx(r1 io.Reader, replacer BytesReplacer) *By
 	if r1 == nil {
 		panic("io.Reader cannot be nil")
 	}
+	r.r = r1
+	r.reset(replacer)
+	return r
+}
+
+// reset sets up the replacer and the buf, and clears all the states, for both BytesReplacingReader and
+// BytesReplacingWriter.
+func (r *BytesReplacingReader) reset(replacer BytesReplacer) {
 	r.replacer = replacer
+	r.replacerEx, _ = replacer.(BytesReplacerEx)
+	r.statsKeyer, _ = replacer.(searchStatsKeyer)
 	maxSearchTokenLen, maxReplaceTokenLen, maxSearchOverReplaceLenRatio := r.replacer.GetSizingHints()
 	if maxSearchTokenLen == 0 {
 		panic("search token cannot be nil/empty")
 	}
 	r.maxSearchTokenLen = maxSearchTokenLen
-	r.r = r1
 	r.err = nil
 	bufSize := max(defaultBufSize, max(maxSearchTokenLen, maxReplaceTokenLen))
+	if maxSearchOverReplaceLenRatio > 0 {
+		// make sure the read bound (see below) leaves room for at least 2 of the longest search
+		// token, or the reader could get stuck with a partial search token filling up buf[:max].
+		bufSize = max(bufSize, int(float64(2*maxSearchTokenLen)/maxSearchOverReplaceLenRatio)+1)
+	}
 	if r.buf == nil || len(r.buf) < bufSize {
 		r.buf = make([]byte, bufSize)
 	}
 	r.buf0 = 0
 	r.buf1 = 0
+	r.output, r.delta, r.count, r.perSearch, r.last = 0, 0, 0, nil, nil
+	if r.offsets != nil {
+		r.offsets.reset()
+	}
 	r.max = len(r.buf)
 	if maxSearchOverReplaceLenRatio > 0 {
 		// If len(search) < len(replace), then we have to assume the worst case:
@@ -73,9 +147,59 @@ func (r *BytesReplacingReader) ResetEx(r1 io.Reader, replacer BytesReplacer) *By
 		// result won't end up exceed the len(buf)?
 		r.max = int(maxSearchOverReplaceLenRatio * float64(len(r.buf)))
 	}
+}
+
+// SetObserver sets a function to be called upon each replacement, in the order the replacements are
+// done, before the replaced bytes are returned by Read. nil removes the observer. The observer stays
+// across Reset/ResetEx.
+func (r *BytesReplacingReader) SetObserver(observer func(Replacement)) *BytesReplacingReader {
+	r.observer = observer
+	return r
+}
+
+// EnablePerSearchTokenStats turns on (or off) counting the replacements per search token, for
+// ReplacingStats.PerSearchToken. It's off by default, as the counters grow with the number of distinct
+// search tokens found. It must be turned on before any read, and stays across Reset/ResetEx.
+func (r *BytesReplacingReader) EnablePerSearchTokenStats(enable bool) *BytesReplacingReader {
+	r.perSearchEnabled = enable
+	r.perSearch, r.last = nil, nil
+	return r
+}
+
+// Stats returns the statistics of the replacements done since the reader was created or last reset.
+func (r *BytesReplacingReader) Stats() ReplacingStats {
+	stats := ReplacingStats{Replacements: r.count}
+	if r.perSearchEnabled {
+		stats.PerSearchToken = make(map[string]int64, len(r.perSearch))
+		for search, c := range r.perSearch {
+			stats.PerSearchToken[search] = c.n
+		}
+	}
+	return stats
+}
+
+// EnableOffsetMap turns on (or off) keeping an offset map, for InputOffset to map output offsets back
+// to input offsets, e.g. for reporting the location in the original input of an error found by a
+// downstream parser. The map grows with the number of replacements changing lengths. It must be turned
+// on before the first Read. The setting stays across Reset/ResetEx.
+func (r *BytesReplacingReader) EnableOffsetMap(enable bool) *BytesReplacingReader {
+	r.offsets = nil
+	if enable {
+		r.offsets = &offsetMap{}
+	}
 	return r
 }
 
+// InputOffset returns the offset in the input stream of the byte at outputOffset in the output stream.
+// The bytes of a replace token map to the bytes of its search token at the same positions, or to the
+// last byte of the search token if the replace token is longer. Panics if the offset map isn't enabled.
+func (r *BytesReplacingReader) InputOffset(outputOffset int64) int64 {
+	if r.offsets == nil {
+		panic("offset map not enabled")
+	}
+	return r.offsets.inputOffset(outputOffset)
+}
+
 // Reset allows reuse of a previous allocated `*BytesReplacingReader` for buf allocation optimization.
 // `search` cannot be nil/empty. `replace` can.
 func (r *BytesReplacingReader) Reset(r1 io.Reader, search1, replace1 []byte) *BytesReplacingReader {
@@ -84,47 +208,146 @@ func (r *BytesReplacingReader) Reset(r1 io.Reader, search1, replace1 []byte) *By
 
 // Read implements the `io.Reader` interface.
 func (r *BytesReplacingReader) Read(p []byte) (int, error) {
-	n := 0
 	for {
 		if r.buf0 > 0 {
-			n = copy(p, r.buf[0:r.buf0])
-			r.buf0 -= n
-			r.buf1 -= n
+			n := copy(p, r.buf[0:r.buf0])
+			r.consume(n)
 			if r.buf1 == 0 && r.err != nil {
 				return n, r.err
 			}
-			copy(r.buf, r.buf[n:r.buf1+n])
 			return n, nil
 		} else if r.err != nil {
 			return 0, r.err
 		}
+		r.fill()
+	}
+}
 
-		n, r.err = r.r.Read(r.buf[r.buf1:r.max])
-		if n > 0 {
-			r.buf1 += n
-			for {
-				index, search, replace := r.replacer.Index(r.buf[r.buf0:r.buf1])
-				if index < 0 {
-					r.buf0 = max(r.buf0, r.buf1-r.maxSearchTokenLen+1)
-					break
-				}
-				searchTokenLen := len(search)
-				if searchTokenLen == 0 {
-					panic("search token cannot be nil/empty")
-				}
-				replaceTokenLen := len(replace)
-				lenDelta := replaceTokenLen - searchTokenLen
-				index += r.buf0
-				copy(r.buf[index+replaceTokenLen:r.buf1+lenDelta], r.buf[index+searchTokenLen:r.buf1])
-				copy(r.buf[index:index+replaceTokenLen], replace)
-				r.buf0 = index + replaceTokenLen
-				r.buf1 += lenDelta
+// WriteTo implements the `io.WriterTo` interface, so that io.Copy writes the replaced bytes directly
+// out of the reader's buf.
+func (r *BytesReplacingReader) WriteTo(w io.Writer) (int64, error) {
+	written := int64(0)
+	for {
+		if r.buf0 > 0 {
+			n, err := w.Write(r.buf[0:r.buf0])
+			if err == nil && n < r.buf0 {
+				err = io.ErrShortWrite
 			}
+			r.consume(n)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			continue
+		} else if r.err == io.EOF {
+			return written, nil
+		} else if r.err != nil {
+			return written, r.err
 		}
-		if r.err != nil {
+		r.fill()
+	}
+}
+
+// fill reads more bytes into buf and does the replacements. Once the input is exhausted, all the
+// bytes in buf are processed.
+func (r *BytesReplacingReader) fill() {
+	var n int
+	n, r.err = r.r.Read(r.buf[r.buf1:r.max])
+	if n > 0 || (r.err != nil && r.replacerEx != nil) {
+		// a BytesReplacerEx may have deferred a match till the end of the input.
+		r.buf1 += n
+		r.replace(r.err != nil)
+	}
+	if r.err != nil {
+		r.buf0 = r.buf1
+	}
+}
+
+// consume drops the first n processed bytes from buf, once they're returned/written out.
+func (r *BytesReplacingReader) consume(n int) {
+	r.output += int64(n)
+	r.buf0 -= n
+	r.buf1 -= n
+	copy(r.buf, r.buf[n:r.buf1+n])
+}
+
+// replace does all the replacements in buf[buf0:buf1], and moves buf0 past the replaced bytes as well
+// as the bytes that can no longer be part of a search token.
+func (r *BytesReplacingReader) replace(atEOF bool) {
+	for {
+		index, search, replace, err := r.index(r.buf[r.buf0:r.buf1], atEOF)
+		if err != nil {
+			r.err = err
+			r.buf1 = r.buf0 + max(index, 0)
 			r.buf0 = r.buf1
+			return
 		}
+		if index < 0 {
+			r.buf0 = max(r.buf0, r.buf1-r.maxSearchTokenLen+1)
+			return
+		}
+		searchTokenLen := len(search)
+		if searchTokenLen == 0 {
+			panic("search token cannot be nil/empty")
+		}
+		replaceTokenLen := len(replace)
+		lenDelta := replaceTokenLen - searchTokenLen
+		index += r.buf0
+		r.record(index, search, replace)
+		copy(r.buf[index+replaceTokenLen:r.buf1+lenDelta], r.buf[index+searchTokenLen:r.buf1])
+		copy(r.buf[index:index+replaceTokenLen], replace)
+		r.buf0 = index + replaceTokenLen
+		r.buf1 += lenDelta
+	}
+}
+
+// record updates the stats and notifies the observer of the replacement at buf[index].
+func (r *BytesReplacingReader) record(index int, search, replace []byte) {
+	outputOffset := r.output + int64(index)
+	if r.offsets != nil {
+		r.offsets.add(outputOffset-r.delta, outputOffset, len(search), len(replace))
+	}
+	if r.observer != nil {
+		r.observer(Replacement{
+			InputOffset:  outputOffset - r.delta,
+			OutputOffset: outputOffset,
+			Search:       search,
+			Replace:      replace,
+		})
+	}
+	r.delta += int64(len(replace) - len(search))
+	r.count++
+	if !r.perSearchEnabled {
+		return
+	}
+	if r.statsKeyer != nil {
+		search = r.statsKeyer.searchStatsKey(search)
+	}
+	if r.last == nil || string(search) != r.last.search {
+		// lookups by string(search) don't allocate, so the counters are pointers to avoid map assignments.
+		r.last = r.perSearch[string(search)]
+		if r.last == nil {
+			if r.perSearch == nil {
+				r.perSearch = make(map[string]*searchCount)
+			}
+			r.last = &searchCount{search: string(search)}
+			r.perSearch[r.last.search] = r.last
+		}
+	}
+	r.last.n++
+}
+
+type searchCount struct {
+	search string
+	n      int64
+}
+
+func (r *BytesReplacingReader) index(buf []byte, atEOF bool) (int, []byte, []byte, error) {
+	if r.replacerEx != nil {
+		return r.replacerEx.IndexEx(buf, atEOF)
 	}
+	index, search, replace := r.replacer.Index(buf)
+	return index, search, replace, nil
 }
 
 type singleSearchReplaceReplacer struct {
@@ -3,10 +3,12 @@ package ios
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -231,3 +233,124 @@ func TestMultiTokenBytesReplacingReader(t *testing.T) {
 		_, _ = ioutil.ReadAll(r)
 	})
 }
+
+func TestBytesReplacingReader_ObserverAndStats(t *testing.T) {
+	input := "a\x00bc\x00\x00d b"
+	expected := "aBBBcd BBB"
+	replacements := map[string]string{"\x00": "", "b": "BBB", "\x00d": "d"}
+	for _, wrap := range []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		iotest.OneByteReader,
+		iotest.HalfReader,
+	} {
+		var observed []Replacement
+		r := NewMultiBytesReplacingReader(wrap(strings.NewReader(input)), replacements).
+			EnablePerSearchTokenStats(true).
+			SetObserver(func(rep Replacement) {
+				rep.Search = append([]byte{}, rep.Search...)
+				rep.Replace = append([]byte{}, rep.Replace...)
+				observed = append(observed, rep)
+			})
+		result, err := ioutil.ReadAll(&oneByteReadsForTest{r})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(result))
+		assert.Equal(t, []Replacement{
+			{InputOffset: 1, OutputOffset: 1, Search: []byte("\x00"), Replace: []byte{}},
+			{InputOffset: 2, OutputOffset: 1, Search: []byte("b"), Replace: []byte("BBB")},
+			{InputOffset: 4, OutputOffset: 5, Search: []byte("\x00"), Replace: []byte{}},
+			{InputOffset: 5, OutputOffset: 5, Search: []byte("\x00d"), Replace: []byte("d")},
+			{InputOffset: 8, OutputOffset: 7, Search: []byte("b"), Replace: []byte("BBB")},
+		}, observed)
+		assert.Equal(t, ReplacingStats{
+			Replacements:   5,
+			PerSearchToken: map[string]int64{"\x00": 2, "b": 2, "\x00d": 1},
+		}, r.Stats())
+
+		// stats are reset, the observer stays.
+		observed = nil
+		r.ResetEx(strings.NewReader("xbx"), NewMultiBytesReplacer(replacements))
+		assert.Equal(t, ReplacingStats{PerSearchToken: map[string]int64{}}, r.Stats())
+		result, err = ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "xBBBx", string(result))
+		assert.Equal(t, []Replacement{
+			{InputOffset: 1, OutputOffset: 1, Search: []byte("b"), Replace: []byte("BBB")},
+		}, observed)
+		assert.Equal(t, ReplacingStats{Replacements: 1, PerSearchToken: map[string]int64{"b": 1}}, r.Stats())
+
+		// per search token stats are off by default.
+		r.EnablePerSearchTokenStats(false)
+		r.ResetEx(strings.NewReader(input), NewMultiBytesReplacer(replacements))
+		_, err = ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, ReplacingStats{Replacements: 5}, r.Stats())
+	}
+}
+
+// oneByteReadsForTest reads one byte at a time out of r, so the bytes returned so far lag behind the
+// bytes replaced.
+type oneByteReadsForTest struct {
+	r io.Reader
+}
+
+func (r *oneByteReadsForTest) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.r.Read(p)
+}
+
+func TestBytesReplacingReader_ObserverOffsets_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for i := 0; i < 100; i++ {
+		input := make([]byte, rnd.Intn(10000))
+		for j := range input {
+			input[j] = "abcd"[rnd.Intn(4)]
+		}
+		replacements := map[string]string{"ab": "x", "c": "yyyy", "dd": ""}
+		var observed []Replacement
+		r := NewMultiBytesReplacingReader(&chunkReaderForTest{r: bytes.NewReader(input), rnd: rnd}, replacements).
+			SetObserver(func(rep Replacement) { observed = append(observed, rep) })
+		result, err := ioutil.ReadAll(&chunkReaderForTest{r: r, rnd: rnd})
+		assert.NoError(t, err)
+		// rebuild the output out of the input and the observed replacements.
+		var rebuilt []byte
+		inputOffset := int64(0)
+		for _, rep := range observed {
+			rebuilt = append(rebuilt, input[inputOffset:rep.InputOffset]...)
+			if !assert.Equal(t, int64(len(rebuilt)), rep.OutputOffset) {
+				return
+			}
+			rebuilt = append(rebuilt, replacements[string(input[rep.InputOffset:rep.InputOffset+int64(len(rep.Search))])]...)
+			inputOffset = rep.InputOffset + int64(len(rep.Search))
+		}
+		rebuilt = append(rebuilt, input[inputOffset:]...)
+		assert.Equal(t, string(result), string(rebuilt))
+		assert.Equal(t, int64(len(observed)), r.Stats().Replacements)
+	}
+}
+
+func TestBytesReplacingReader_WriteTo(t *testing.T) {
+	input := createTestInput(100*1024, 500)
+	expected := bytes.ReplaceAll(input, testSearchFor, []byte{8, 9, 10})
+	r := NewBytesReplacingReader(bytes.NewReader(input), testSearchFor, []byte{8, 9, 10})
+	var out bytes.Buffer
+	n, err := r.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(expected)), n)
+	assert.Equal(t, string(expected), out.String())
+	n, err = r.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	fw := &failingWriterForTest{limit: 3}
+	n, err = NewBytesReplacingReader(strings.NewReader("abcde"), []byte("c"), []byte("x")).WriteTo(fw)
+	assert.EqualError(t, err, "disk full")
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, "abx", fw.out.String())
+
+	n, err = NewBytesReplacingReader(iotest.TimeoutReader(strings.NewReader("abcde")), []byte("c"), []byte("x")).
+		WriteTo(&out)
+	assert.Equal(t, iotest.ErrTimeout, err)
+	assert.Equal(t, int64(5), n)
+}
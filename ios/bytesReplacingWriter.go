@@ -0,0 +1,202 @@
+package ios
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrWriterClosed is returned by BytesReplacingWriter upon Write/Flush after Close.
+var ErrWriterClosed = errors.New("write to closed BytesReplacingWriter")
+
+// BytesReplacingWriter is the push mode counterpart of BytesReplacingReader: it does the replacements
+// on the bytes written into it, before writing them into the underlying io.Writer. Because a search
+// token can be split across Write calls, the trailing bytes of a Write that might start a search token
+// are held back, until more bytes are written or the writer is closed. Close must be called to write
+// out all the remaining bytes.
+type BytesReplacingWriter struct {
+	w      io.Writer
+	closed bool
+	// BytesReplacingReader does all the buffering and replacements; its buf[0:buf0] are the bytes to
+	// be written out.
+	r BytesReplacingReader
+}
+
+// ResetEx allows reuse of a previous allocated `*BytesReplacingWriter` for buf allocation optimization.
+// Any bytes not yet written out are dropped.
+func (w *BytesReplacingWriter) ResetEx(w1 io.Writer, replacer BytesReplacer) *BytesReplacingWriter {
+	if w1 == nil {
+		panic("io.Writer cannot be nil")
+	}
+	w.w = w1
+	w.closed = false
+	w.r.reset(replacer)
+	return w
+}
+
+// Reset allows reuse of a previous allocated `*BytesReplacingWriter` for buf allocation optimization.
+// `search` cannot be nil/empty. `replace` can.
+func (w *BytesReplacingWriter) Reset(w1 io.Writer, search1, replace1 []byte) *BytesReplacingWriter {
+	return w.ResetEx(w1, &singleSearchReplaceReplacer{search: search1, replace: replace1})
+}
+
+// SetObserver sets a function to be called upon each replacement. See BytesReplacingReader.SetObserver.
+func (w *BytesReplacingWriter) SetObserver(observer func(Replacement)) *BytesReplacingWriter {
+	w.r.SetObserver(observer)
+	return w
+}
+
+// EnablePerSearchTokenStats turns on (or off) counting the replacements per search token. See
+// BytesReplacingReader.EnablePerSearchTokenStats.
+func (w *BytesReplacingWriter) EnablePerSearchTokenStats(enable bool) *BytesReplacingWriter {
+	w.r.EnablePerSearchTokenStats(enable)
+	return w
+}
+
+// Stats returns the statistics of the replacements done since the writer was created or last reset.
+func (w *BytesReplacingWriter) Stats() ReplacingStats {
+	return w.r.Stats()
+}
+
+// EnableOffsetMap turns on (or off) keeping an offset map. See BytesReplacingReader.EnableOffsetMap.
+func (w *BytesReplacingWriter) EnableOffsetMap(enable bool) *BytesReplacingWriter {
+	w.r.EnableOffsetMap(enable)
+	return w
+}
+
+// InputOffset returns the offset in the input stream of the byte at outputOffset in the output stream.
+// See BytesReplacingReader.InputOffset.
+func (w *BytesReplacingWriter) InputOffset(outputOffset int64) int64 {
+	return w.r.InputOffset(outputOffset)
+}
+
+// Write implements the `io.Writer` interface. Once an error is returned, either from the underlying
+// io.Writer or from a BytesReplacerEx, all subsequent calls return the same error.
+func (w *BytesReplacingWriter) Write(p []byte) (int, error) {
+	if err := w.check(); err != nil {
+		return 0, err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.r.buf[w.r.buf1:w.r.max], p)
+		w.r.buf1 += n
+		w.r.replace(false)
+		if err := w.writeOut(); err != nil {
+			return written, err
+		}
+		if w.r.err != nil {
+			return written, w.r.err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// ReadFrom implements the `io.ReaderFrom` interface, so that io.Copy reads directly into the writer's
+// buf. Same as io.Copy, it doesn't close the writer once r is exhausted.
+func (w *BytesReplacingWriter) ReadFrom(r io.Reader) (int64, error) {
+	if err := w.check(); err != nil {
+		return 0, err
+	}
+	read := int64(0)
+	for {
+		n, err := r.Read(w.r.buf[w.r.buf1:w.r.max])
+		read += int64(n)
+		if n > 0 {
+			w.r.buf1 += n
+			w.r.replace(false)
+			if err := w.writeOut(); err != nil {
+				return read, err
+			}
+			if w.r.err != nil {
+				return read, w.r.err
+			}
+		}
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+// Flush writes out all the bytes that can no longer be part of a search token, then flushes the
+// underlying io.Writer, if it has a `Flush() error` or `Flush()` (e.g. http.Flusher) method. The bytes
+// that might start a search token are still held back.
+func (w *BytesReplacingWriter) Flush() error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	if err := w.writeOut(); err != nil {
+		return err
+	}
+	return flush(w.w)
+}
+
+// Close does the replacements on all the remaining bytes and writes them out, as the end of the input
+// is reached. It doesn't close the underlying io.Writer. Close is idempotent.
+func (w *BytesReplacingWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.check(); err != nil {
+		return err
+	}
+	w.r.replace(true)
+	if w.r.err == nil {
+		w.r.buf0 = w.r.buf1
+	}
+	if err := w.writeOut(); err != nil {
+		return err
+	}
+	if w.r.err != nil {
+		return w.r.err
+	}
+	w.closed = true
+	return flush(w.w)
+}
+
+func (w *BytesReplacingWriter) check() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	return w.r.err
+}
+
+// writeOut writes out buf[0:buf0], i.e. the bytes already processed.
+func (w *BytesReplacingWriter) writeOut() error {
+	if w.r.buf0 == 0 {
+		return nil
+	}
+	n, err := w.w.Write(w.r.buf[0:w.r.buf0])
+	if err == nil && n < w.r.buf0 {
+		err = io.ErrShortWrite
+	}
+	w.r.consume(n)
+	if err != nil && w.r.err == nil {
+		w.r.err = err
+	}
+	return err
+}
+
+func flush(w io.Writer) error {
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// NewBytesReplacingWriter creates a new `*BytesReplacingWriter` for a single pair of search:replace token
+// replacement. `search` cannot be nil/empty. `replace` can.
+func NewBytesReplacingWriter(w io.Writer, search, replace []byte) *BytesReplacingWriter {
+	return (&BytesReplacingWriter{}).Reset(w, search, replace)
+}
+
+// NewBytesReplacingWriterEx creates a new `*BytesReplacingWriter` for a given BytesReplacer customization.
+func NewBytesReplacingWriterEx(w io.Writer, replacer BytesReplacer) *BytesReplacingWriter {
+	return (&BytesReplacingWriter{}).ResetEx(w, replacer)
+}
@@ -0,0 +1,182 @@
+package ios
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jf-tech/go-corelib/maths"
+)
+
+func TestBytesReplacingWriter(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		replacer func() BytesReplacer
+		expected string
+	}{
+		{
+			name:     "single token, len(replace) > len(search)",
+			input:    "abcbcdbbc",
+			replacer: func() BytesReplacer { return &singleSearchReplaceReplacer{[]byte("bc"), []byte("xyz")} },
+			expected: "axyzxyzdbxyz",
+		},
+		{
+			name:     "single token, len(replace) < len(search)",
+			input:    "abcbcdbbcb",
+			replacer: func() BytesReplacer { return &singleSearchReplaceReplacer{[]byte("bcb"), nil} },
+			expected: "acdb",
+		},
+		{
+			name:  "multi tokens, longest wins",
+			input: "he said she sells",
+			replacer: func() BytesReplacer {
+				return NewMultiBytesReplacer(map[string]string{"he": "1", "she": "3", "s": "4", "sells": "5"})
+			},
+			expected: "1 4aid 3 5",
+		},
+		{
+			name:     "regex",
+			input:    "call 555-1234 or 555-9876",
+			replacer: func() BytesReplacer { return NewRegexReplacer(regexp.MustCompile(`\d{3}-(\d{4})`), "***-$1", 8) },
+			expected: "call ***-1234 or ***-9876",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for chunkSize := 1; chunkSize <= len(test.input); chunkSize++ {
+				var out bytes.Buffer
+				w := NewBytesReplacingWriterEx(&out, test.replacer())
+				for input := test.input; len(input) > 0; {
+					chunk := input[:maths.MinInt(chunkSize, len(input))]
+					n, err := w.Write([]byte(chunk))
+					assert.NoError(t, err)
+					assert.Equal(t, len(chunk), n)
+					input = input[len(chunk):]
+				}
+				assert.NoError(t, w.Close())
+				assert.Equal(t, test.expected, out.String(), "chunk size: %d", chunkSize)
+			}
+		})
+	}
+
+	assert.PanicsWithValue(t, "io.Writer cannot be nil", func() {
+		NewBytesReplacingWriter(nil, []byte("a"), []byte("b"))
+	})
+	assert.PanicsWithValue(t, "search token cannot be nil/empty", func() {
+		NewBytesReplacingWriter(&bytes.Buffer{}, nil, []byte("b"))
+	})
+}
+
+func TestBytesReplacingWriter_FlushAndClose(t *testing.T) {
+	var out bytes.Buffer
+	bw := bufio.NewWriter(&out)
+	w := NewBytesReplacingWriter(bw, []byte("abc"), []byte("x"))
+	_, err := w.Write([]byte("123ab"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", out.String())
+	// "ab" might be the start of "abc", so it's held back, while the underlying bufio.Writer is flushed.
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "123", out.String())
+	_, err = w.Write([]byte("c4ab"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "123x4ab", out.String())
+	assert.NoError(t, w.Close())
+	_, err = w.Write([]byte("a"))
+	assert.Equal(t, ErrWriterClosed, err)
+	assert.Equal(t, ErrWriterClosed, w.Flush())
+
+	// http.Flusher
+	rec := httptest.NewRecorder()
+	w.Reset(rec, []byte("abc"), []byte("x"))
+	_, err = w.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "x", rec.Body.String())
+}
+
+type failingWriterForTest struct {
+	limit int
+	out   bytes.Buffer
+}
+
+func (w *failingWriterForTest) Write(p []byte) (int, error) {
+	if w.out.Len()+len(p) > w.limit {
+		n, _ := w.out.Write(p[:w.limit-w.out.Len()])
+		return n, errors.New("disk full")
+	}
+	return w.out.Write(p)
+}
+
+func TestBytesReplacingWriter_Errors(t *testing.T) {
+	fw := &failingWriterForTest{limit: 5}
+	w := NewBytesReplacingWriter(fw, []byte("a"), []byte("xx"))
+	_, err := w.Write([]byte("aab"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("aab"))
+	assert.EqualError(t, err, "disk full")
+	assert.Equal(t, "xxxxb", fw.out.String())
+	_, err = w.Write([]byte("c"))
+	assert.EqualError(t, err, "disk full")
+	assert.EqualError(t, w.Close(), "disk full")
+
+	var out bytes.Buffer
+	w = NewBytesReplacingWriterEx(&out, NewRegexReplacer(regexp.MustCompile(`\d+`), "#", 3))
+	_, err = w.Write([]byte("a 12 b 3456 c"))
+	assert.True(t, errors.Is(err, ErrRegexMatchTooLong))
+	assert.Equal(t, "a # b ", out.String())
+	assert.True(t, errors.Is(w.Close(), ErrRegexMatchTooLong))
+}
+
+func TestBytesReplacingWriter_ReadFromAndStats(t *testing.T) {
+	var out bytes.Buffer
+	w := NewBytesReplacingWriter(&out, []byte("\x00"), nil).EnableOffsetMap(true).EnablePerSearchTokenStats(true)
+	var offsets []int64
+	w.SetObserver(func(rep Replacement) { offsets = append(offsets, rep.InputOffset) })
+	n, err := io.Copy(w, strings.NewReader("a\x00b\x00\x00"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "ab", out.String())
+	assert.Equal(t, []int64{1, 3, 4}, offsets)
+	assert.Equal(t, int64(2), w.InputOffset(1))
+	assert.Equal(t, ReplacingStats{Replacements: 3, PerSearchToken: map[string]int64{"\x00": 3}}, w.Stats())
+}
+
+func TestBytesReplacingWriter_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for i := 0; i < 100; i++ {
+		input := make([]byte, rnd.Intn(10000))
+		for j := range input {
+			input[j] = "abcd"[rnd.Intn(4)]
+		}
+		replacements := map[string]string{"ab": "x", "abc": "yyyy", "dd": "", "cad": "zzzzzzzzz"}
+		expected := replaceLeftmostLongestForTest(input, replacements)
+		var out bytes.Buffer
+		w := NewBytesReplacingWriterEx(&out, NewMultiBytesReplacer(replacements))
+		if i%2 == 0 {
+			_, err := io.Copy(w, &chunkReaderForTest{r: bytes.NewReader(input), rnd: rnd})
+			assert.NoError(t, err)
+		} else {
+			for p := input; len(p) > 0; {
+				n := maths.MinInt(len(p), 1+rnd.Intn(100))
+				_, err := w.Write(p[:n])
+				assert.NoError(t, err)
+				p = p[n:]
+			}
+		}
+		assert.NoError(t, w.Close())
+		if !assert.Equal(t, string(expected), out.String()) {
+			return
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ios
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 
 	"github.com/jf-tech/go-corelib/maths"
@@ -13,6 +14,86 @@ import (
 // appending at the end of the original `line` will result in undefined behavior.
 type LineEditFunc func(line []byte) ([]byte, error)
 
+// LineContext is the context of a line passed into a LineEditFunc2. It, as well as all the []byte in it,
+// is only valid during the LineEditFunc2 call.
+type LineContext struct {
+	// LineNum is the 1-based line number of the line in the input.
+	LineNum int
+	// Offset is the byte offset of the line in the input.
+	Offset int64
+	// Line is the line, including its terminator, if any (the last line before EOF might not have one).
+	// Same as LineEditFunc, Line can be edited in-place.
+	Line []byte
+	// Next is the lines following Line in the input, unedited, up to the window size of the
+	// LineEditingReader; fewer towards the end of the input. Next must not be edited.
+	Next [][]byte
+	// SkipNext can be set by LineEditFunc2 to the number of lines in Next it has taken care of, e.g.
+	// folded into the resulting lines. The skipped lines are dropped without being edited.
+	SkipNext int
+	lines    [][]byte
+}
+
+// Lines returns the given lines, to be returned by a LineEditFunc2, e.g. `return ctx.Lines(ctx.Line), nil`.
+// It saves the allocation of a [][]byte per line, by reusing the same one across the calls.
+func (c *LineContext) Lines(lines ...[]byte) [][]byte {
+	c.lines = append(c.lines[:0], lines...)
+	return c.lines
+}
+
+// LineEditFunc2 edits a line given its context, and returns the resulting lines, each of which is
+// written out as is, i.e. must include its own terminator if needed. To keep the line, return
+// ctx.Lines(ctx.Line); to drop it, return nil; to replace it, return the new line; to split it, return
+// multiple lines.
+type LineEditFunc2 func(ctx *LineContext) ([][]byte, error)
+
+// LineTooLongPolicy tells LineEditingReader what to do with a line longer than the max line length.
+type LineTooLongPolicy int
+
+const (
+	// LineTooLongError stops the reading with an *ErrLineTooLong. The caller can resume the reading
+	// by LineEditingReader.SkipLongLine or LineEditingReader.TruncateLongLine, deciding line by line.
+	LineTooLongError LineTooLongPolicy = iota
+	// LineTooLongTruncate truncates the line to the max line length (keeping its terminator), before
+	// editing it.
+	LineTooLongTruncate
+	// LineTooLongSkip drops the line without editing it.
+	LineTooLongSkip
+)
+
+// ErrLineTooLong is returned by LineEditingReader, with LineTooLongError, upon a line longer than the
+// max line length. All the lines before it have been read by then. Unless the reading is resumed by
+// SkipLongLine or TruncateLongLine, all subsequent Read calls return the same error.
+type ErrLineTooLong struct {
+	// LineNum is the 1-based line number of the line in the input.
+	LineNum int
+	// Offset is the byte offset of the line in the input.
+	Offset int64
+	// MaxLineLen is the max line length exceeded.
+	MaxLineLen int
+}
+
+func (e *ErrLineTooLong) Error() string {
+	return fmt.Sprintf("line %d at offset %d exceeds max line length %d", e.LineNum, e.Offset, e.MaxLineLen)
+}
+
+// UnicodeLineTerminators are all the mandatory line breaks of Unicode (see UAX #14), for
+// LineEditingReaderOptions.Terminators.
+var UnicodeLineTerminators = []string{"\r\n", "\n", "\r", "\v", "\f", "\u0085", "\u2028", "\u2029"}
+
+// LineEditingReaderOptions customizes how LineEditingReader splits its input into lines.
+type LineEditingReaderOptions struct {
+	// Terminators are the byte sequences lines end with, "\n" if none; note with "\n" alone, lines
+	// ending with "\r\n" work too, with '\r' being part of the line. E.g. {"\r"} for old Mac files,
+	// {"\r\n"} for "\r\n" only, or UnicodeLineTerminators. When multiple terminators are found at the
+	// same position, the longest wins, e.g. "\r\n" over "\r".
+	Terminators []string
+	// MaxLineLen is the max length of a line, excluding its terminator; 0 means no limit. Without a
+	// limit, LineEditingReader keeps growing its buf until the end of the line.
+	MaxLineLen int
+	// LineTooLong tells what to do with a line longer than MaxLineLen.
+	LineTooLong LineTooLongPolicy
+}
+
 // LineEditingReader implements io.Reader interface with a line editing mechanism. LineEditingReader reads data from
 // underlying io.Reader and invokes the caller supplied edit function for each of the line (defined as
 // []byte ending with '\n', therefore it works on both Mac/Linux and Windows, where '\r\n' is used).
@@ -20,7 +101,8 @@ type LineEditFunc func(line []byte) ([]byte, error)
 // flexible: the editing function can do in-place editing such as character replacement, prefix/suffix
 // stripping, or word replacement, etc., as long as the line length isn't changed; or it can replace a line
 // with a completely newly allocated and written line with no length restriction (although performance
-// would be slower compared to in-place editing).
+// would be slower compared to in-place editing). Line terminators other than '\n', as well as a max line
+// length, can be set by SetOptions.
 type LineEditingReader struct {
 	r       io.Reader
 	edit    LineEditFunc
@@ -29,18 +111,178 @@ type LineEditingReader struct {
 	buf0    int    // buf[:buf0] edited line(s) ready to be returned to caller.
 	buf1    int    // buf[buf0:buf1] unedited lines.
 	err     error
+	// only used with LineEditFunc2.
+	edit2   LineEditFunc2
+	window  int
+	ctx     LineContext
+	scratch []byte
+	// line terminator, if only one; otherwise terminators.
+	terminator  []byte
+	terminators *MultiBytesReplacer
+	maxTermLen  int
+	maxLineLen  int
+	lineTooLong LineTooLongPolicy
+	// tooLong is set once the line at buf0 is found too long; then the bytes after its first keep bytes
+	// are discarded till its terminator. keep is 0 if the line is to be skipped, instead of truncated.
+	tooLong   bool
+	keep      int
+	discarded int64
+	// errBeforeTooLong is the error from r, if any, when r.err is set to an *ErrLineTooLong.
+	errBeforeTooLong error
+}
+
+// SetOptions customizes how the reader splits its input into lines. It must be called before the first
+// Read.
+func (r *LineEditingReader) SetOptions(opts LineEditingReaderOptions) *LineEditingReader {
+	if opts.MaxLineLen < 0 {
+		panic(fmt.Sprintf("max line length must be >= 0, instead got: %d", opts.MaxLineLen))
+	}
+	r.terminator, r.terminators, r.maxTermLen = []byte{'\n'}, nil, 1
+	switch len(opts.Terminators) {
+	case 0:
+	case 1:
+		if opts.Terminators[0] == "" {
+			panic("line terminator cannot be empty")
+		}
+		r.terminator, r.maxTermLen = []byte(opts.Terminators[0]), len(opts.Terminators[0])
+	default:
+		replacements := make(map[string]string, len(opts.Terminators))
+		for _, term := range opts.Terminators {
+			if term == "" {
+				panic("line terminator cannot be empty")
+			}
+			replacements[term] = term
+			r.maxTermLen = maths.MaxInt(r.maxTermLen, len(term))
+		}
+		r.terminator, r.terminators = nil, NewMultiBytesReplacer(replacements)
+	}
+	r.maxLineLen = opts.MaxLineLen
+	r.lineTooLong = opts.LineTooLong
+	return r
 }
 
+// findTerminator returns the index of the first line terminator in buf and its length. The index is -1
+// if none is found, or, with multiple terminators, if the one found might be part of a longer one.
+func (r *LineEditingReader) findTerminator(buf []byte) (int, int) {
+	switch {
+	case r.terminators != nil:
+		index, term, _, _ := r.terminators.IndexEx(buf, r.err == io.EOF)
+		return index, len(term)
+	case len(r.terminator) == 1:
+		return bytes.IndexByte(buf, r.terminator[0]), 1
+	default:
+		return bytes.Index(buf, r.terminator), len(r.terminator)
+	}
+}
+
+// scanEndOfLine returns the length of the line, including its terminator, at the beginning of buf, or
+// -1 if its end isn't in buf yet.
 func (r *LineEditingReader) scanEndOfLine(buf []byte) int {
-	if lf := bytes.IndexByte(buf, '\n'); lf >= 0 {
-		return lf
+	if index, termLen := r.findTerminator(buf); index >= 0 {
+		return index + termLen
 	}
-	if r.err == io.EOF {
-		return len(buf) - 1
+	if r.err == io.EOF && len(buf) > 0 {
+		return len(buf)
 	}
 	return -1
 }
 
+// nextLine returns the length of the line at buf0, or -1 if its end isn't in buf yet (or on a line too
+// long with LineTooLongError). Lines too long are truncated or skipped in buf.
+func (r *LineEditingReader) nextLine() int {
+	for {
+		start := r.buf0
+		if r.tooLong {
+			start += r.keep
+		}
+		index, termLen := r.findTerminator(r.buf[start:r.buf1])
+		atEOF := r.err == io.EOF
+		if !r.tooLong && r.maxLineLen > 0 {
+			lineLen := index
+			if index < 0 {
+				// the last bytes might be a partial terminator.
+				lineLen = r.buf1 - start
+				if !atEOF {
+					lineLen -= r.maxTermLen - 1
+				}
+			}
+			if lineLen > r.maxLineLen {
+				if r.lineTooLong == LineTooLongError {
+					r.errBeforeTooLong = r.err
+					r.err = &ErrLineTooLong{LineNum: r.ctx.LineNum + 1, Offset: r.ctx.Offset, MaxLineLen: r.maxLineLen}
+					return -1
+				}
+				r.tooLong = true
+				r.keep = 0
+				if r.lineTooLong == LineTooLongTruncate {
+					r.keep = r.maxLineLen
+				}
+				continue
+			}
+		}
+		if !r.tooLong {
+			return r.scanEndOfLine(r.buf[r.buf0:r.buf1])
+		}
+		end := r.buf1
+		switch {
+		case index >= 0:
+			end = start + index
+		case !atEOF:
+			// keep what might be a partial terminator.
+			end = maths.MaxInt(start, r.buf1-(r.maxTermLen-1))
+		}
+		r.discard(start, end)
+		if index < 0 && !atEOF {
+			return -1
+		}
+		r.tooLong = false
+		lineLen := r.keep
+		if index >= 0 {
+			lineLen += termLen
+		}
+		if r.keep > 0 {
+			// truncated.
+			return lineLen
+		}
+		r.discard(r.buf0, r.buf0+lineLen)
+		r.ctx.LineNum++
+		r.ctx.Offset += r.discarded
+		r.discarded = 0
+		if atEOF && r.buf0 == r.buf1 {
+			return -1
+		}
+	}
+}
+
+// SkipLongLine resumes the reading after an *ErrLineTooLong, by dropping the line too long, same as
+// LineTooLongSkip. It panics if the last error returned by Read isn't an *ErrLineTooLong.
+func (r *LineEditingReader) SkipLongLine() {
+	r.resumeLongLine(0)
+}
+
+// TruncateLongLine resumes the reading after an *ErrLineTooLong, by truncating the line too long to the
+// max line length, same as LineTooLongTruncate. It panics if the last error returned by Read isn't an
+// *ErrLineTooLong.
+func (r *LineEditingReader) TruncateLongLine() {
+	r.resumeLongLine(r.maxLineLen)
+}
+
+func (r *LineEditingReader) resumeLongLine(keep int) {
+	if _, ok := r.err.(*ErrLineTooLong); !ok {
+		panic("no line too long to resume from")
+	}
+	r.err, r.errBeforeTooLong = r.errBeforeTooLong, nil
+	r.tooLong, r.keep = true, keep
+	r.editLines()
+}
+
+// discard drops buf[from:to] of the line at buf0.
+func (r *LineEditingReader) discard(from, to int) {
+	copy(r.buf[from:], r.buf[to:r.buf1])
+	r.buf1 -= to - from
+	r.discarded += int64(to - from)
+}
+
 // Read implements io.Reader interface for LineEditingReader.
 func (r *LineEditingReader) Read(p []byte) (int, error) {
 	n := 0
@@ -63,53 +305,119 @@ func (r *LineEditingReader) Read(p []byte) (int, error) {
 
 		n, r.err = r.r.Read(r.buf[r.buf1:])
 		r.buf1 += n
-		lf := r.scanEndOfLine(r.buf[r.buf0:r.buf1])
-		for ; lf >= 0; lf = r.scanEndOfLine(r.buf[r.buf0:r.buf1]) {
-			lineLen := lf + 1
-			edited, err := r.edit(r.buf[r.buf0 : r.buf0+lineLen])
-			if err != nil {
-				r.err = err
-				break
-			}
-			editedLen := len(edited)
-			delta := lineLen - editedLen
-			if len(r.buf)-r.buf1+delta < 0 {
-				// only expand the buf if there is no room left for the edited line growth.
-				newBuf := make([]byte, len(r.buf)+maths.MaxInt(r.bufSize, -delta))
-				copy(newBuf, r.buf[:r.buf1])
-				r.buf = newBuf
-			}
-			if delta > 0 {
-				// This is the case where the edited line is shorter than the original line.
-				// Image we have:
-				//  xyz\nabc
-				// where "xyz\n" is in-placed edited to drop the first letter to "yz\n".
-				// If we shift "abc" up by delta (1) first, then we would've overwritten the "\n" in "yz\n"
-				// and the edited would now be "yza".
-				// Therefore, if edited is shorter, we need to move/copy edited to be at buf0 first
-				// before we shift the rest of the buffer (up to buf1) up.
-				copy(r.buf[r.buf0:r.buf0+editedLen], edited)
-				copy(r.buf[r.buf0+editedLen:r.buf1-delta], r.buf[r.buf0+lineLen:r.buf1])
-			} else {
-				// Now if edited is longer, we need to move the rest buffer out first, before we can copy
-				// the edited into the buffer.
-				copy(r.buf[r.buf0+editedLen:r.buf1-delta], r.buf[r.buf0+lineLen:r.buf1])
-				copy(r.buf[r.buf0:r.buf0+editedLen], edited)
+		r.editLines()
+	}
+}
+
+// editLines edits all the complete lines in buf[buf0:buf1].
+func (r *LineEditingReader) editLines() {
+	for lineLen := r.nextLine(); lineLen >= 0; lineLen = r.nextLine() {
+		var edited []byte
+		var err error
+		if r.edit2 != nil {
+			if !r.scanWindow(lineLen) {
+				// need more input to fill up the window.
+				return
 			}
-			r.buf0 += editedLen
-			r.buf1 -= delta
+			edited, lineLen, err = r.editWithContext(lineLen)
+		} else {
+			r.ctx.LineNum++
+			edited, err = r.edit(r.buf[r.buf0 : r.buf0+lineLen])
 		}
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.ctx.Offset += int64(lineLen) + r.discarded
+		r.discarded = 0
+		editedLen := len(edited)
+		delta := lineLen - editedLen
+		if len(r.buf)-r.buf1+delta < 0 {
+			// only expand the buf if there is no room left for the edited line growth.
+			newBuf := make([]byte, len(r.buf)+maths.MaxInt(r.bufSize, -delta))
+			copy(newBuf, r.buf[:r.buf1])
+			r.buf = newBuf
+		}
+		if delta > 0 {
+			// This is the case where the edited line is shorter than the original line.
+			// Image we have:
+			//  xyz\nabc
+			// where "xyz\n" is in-placed edited to drop the first letter to "yz\n".
+			// If we shift "abc" up by delta (1) first, then we would've overwritten the "\n" in "yz\n"
+			// and the edited would now be "yza".
+			// Therefore, if edited is shorter, we need to move/copy edited to be at buf0 first
+			// before we shift the rest of the buffer (up to buf1) up.
+			copy(r.buf[r.buf0:r.buf0+editedLen], edited)
+			copy(r.buf[r.buf0+editedLen:r.buf1-delta], r.buf[r.buf0+lineLen:r.buf1])
+		} else {
+			// Now if edited is longer, we need to move the rest buffer out first, before we can copy
+			// the edited into the buffer.
+			copy(r.buf[r.buf0+editedLen:r.buf1-delta], r.buf[r.buf0+lineLen:r.buf1])
+			copy(r.buf[r.buf0:r.buf0+editedLen], edited)
+		}
+		r.buf0 += editedLen
+		r.buf1 -= delta
+	}
+}
+
+// scanWindow collects into ctx.Next the lines following the line of lineLen at buf0, up to the window
+// size. Returns false if the window can't be filled up until more input is read in.
+func (r *LineEditingReader) scanWindow(lineLen int) bool {
+	r.ctx.Next = r.ctx.Next[:0]
+	for start := r.buf0 + lineLen; len(r.ctx.Next) < r.window; {
+		nextLen := r.scanEndOfLine(r.buf[start:r.buf1])
+		if nextLen < 0 {
+			// at the end of the input, or on an error, the window is as full as it can be. So it is,
+			// with a line too long to be held in buf.
+			return r.err != nil || (r.maxLineLen > 0 && r.buf1-start-(r.maxTermLen-1) > r.maxLineLen)
+		}
+		r.ctx.Next = append(r.ctx.Next, r.buf[start:start+nextLen])
+		start += nextLen
+	}
+	return true
+}
+
+// editWithContext calls the LineEditFunc2 on the line of lineLen at buf0, and returns the edited
+// line(s) along with the number of bytes taken care of, i.e. the line plus any next lines skipped.
+func (r *LineEditingReader) editWithContext(lineLen int) ([]byte, int, error) {
+	line := r.buf[r.buf0 : r.buf0+lineLen]
+	r.ctx.LineNum++
+	r.ctx.Line = line
+	r.ctx.SkipNext = 0
+	lines, err := r.edit2(&r.ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.ctx.SkipNext < 0 || r.ctx.SkipNext > len(r.ctx.Next) {
+		panic(fmt.Sprintf("SkipNext must be within [0, %d], instead got: %d", len(r.ctx.Next), r.ctx.SkipNext))
+	}
+	for _, next := range r.ctx.Next[:r.ctx.SkipNext] {
+		lineLen += len(next)
+	}
+	r.ctx.LineNum += r.ctx.SkipNext
+	if len(lines) == 1 && len(lines[0]) > 0 && len(lines[0]) <= len(line) && &lines[0][0] == &line[0] {
+		// line kept, or edited in-place into a prefix of line.
+		return lines[0], lineLen, nil
 	}
+	// the resulting lines might point into the next lines, which are about to be moved around, so they
+	// are copied out first.
+	r.scratch = r.scratch[:0]
+	for _, l := range lines {
+		r.scratch = append(r.scratch, l...)
+	}
+	return r.scratch, lineLen, nil
 }
 
 // NewLineEditingReader2 creates a new LineEditingReader with custom buffer size.
 func NewLineEditingReader2(r io.Reader, edit LineEditFunc, bufSize int) *LineEditingReader {
 	buf := make([]byte, bufSize)
 	return &LineEditingReader{
-		r:       r,
-		edit:    edit,
-		bufSize: bufSize,
-		buf:     buf,
+		r:          r,
+		edit:       edit,
+		bufSize:    bufSize,
+		buf:        buf,
+		terminator: []byte{'\n'},
+		maxTermLen: 1,
 	}
 }
 
@@ -121,3 +429,15 @@ const (
 func NewLineEditingReader(r io.Reader, edit LineEditFunc) *LineEditingReader {
 	return NewLineEditingReader2(r, edit, defaultLineEditingReaderBufSize)
 }
+
+// NewLineEditingReaderEx creates a new LineEditingReader with the default buffer size, editing each line
+// by a LineEditFunc2 given the context of the line, including the next `window` lines.
+func NewLineEditingReaderEx(r io.Reader, edit LineEditFunc2, window int) *LineEditingReader {
+	if window < 0 {
+		panic(fmt.Sprintf("window must be >= 0, instead got: %d", window))
+	}
+	lr := NewLineEditingReader2(r, nil, defaultLineEditingReaderBufSize)
+	lr.edit2 = edit
+	lr.window = window
+	return lr
+}
@@ -1,10 +1,14 @@
 package ios
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -132,6 +136,20 @@ func BenchmarkLineEditingReader_UseLineEditingReader(b *testing.B) {
 	}
 }
 
+func BenchmarkLineEditingReader_UseLineEditingReaderEx(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ioutil.ReadAll(
+			NewLineEditingReaderEx(
+				strings.NewReader(lineEditingReaderBenchInput),
+				func(ctx *LineContext) ([][]byte, error) {
+					if len(ctx.Line) < 2 || ctx.Line[0] != '|' {
+						return ctx.Lines(ctx.Line), nil
+					}
+					return ctx.Lines(ctx.Line[1:]), nil
+				}, 0))
+	}
+}
+
 func BenchmarkLineEditingReader_CompareWithBytesReplacingReader(b *testing.B) {
 	search := []byte("|H")
 	replace := []byte("H")
@@ -143,3 +161,319 @@ func BenchmarkLineEditingReader_CompareWithBytesReplacingReader(b *testing.B) {
 				replace))
 	}
 }
+
+func TestLineEditingReaderEx(t *testing.T) {
+	input := "HDR|a\r\nDAT|1\n  continued\n\tand more\nDAT|2\nDAT|3\n  tail\nEOF"
+	for _, test := range []struct {
+		name     string
+		edit     LineEditFunc2
+		window   int
+		expected string
+		err      string
+	}{
+		{
+			name: "keep",
+			edit: func(ctx *LineContext) ([][]byte, error) {
+				return ctx.Lines(ctx.Line), nil
+			},
+			expected: input,
+		},
+		{
+			name: "drop header, in-place edit and replace by line numbers",
+			edit: func(ctx *LineContext) ([][]byte, error) {
+				switch {
+				case ctx.LineNum == 1:
+					return nil, nil
+				case ctx.LineNum >= 3 && ctx.LineNum <= 4:
+					return [][]byte{bytes.TrimLeft(ctx.Line, " \t")}, nil
+				case ctx.LineNum == 5:
+					ctx.Line[0] = 'd'
+					return [][]byte{ctx.Line[:2]}, nil
+				case ctx.LineNum == 8:
+					return [][]byte{[]byte(fmt.Sprintf("EOF@%d", ctx.Offset))}, nil
+				}
+				return [][]byte{ctx.Line}, nil
+			},
+			expected: "DAT|1\ncontinued\nand more\ndADAT|3\n  tail\nEOF@54",
+		},
+		{
+			name: "split",
+			edit: func(ctx *LineContext) ([][]byte, error) {
+				if parts := bytes.SplitN(ctx.Line, []byte("|"), 2); len(parts) == 2 {
+					return [][]byte{append(parts[0], '\n'), parts[1]}, nil
+				}
+				return [][]byte{ctx.Line}, nil
+			},
+			expected: "HDR\na\r\nDAT\n1\n  continued\n\tand more\nDAT\n2\nDAT\n3\n  tail\nEOF",
+		},
+		{
+			name: "fold continuation lines with window",
+			edit: func(ctx *LineContext) ([][]byte, error) {
+				line := [][]byte{bytes.TrimRight(ctx.Line, "\r\n")}
+				for _, next := range ctx.Next {
+					if next[0] != ' ' && next[0] != '\t' {
+						break
+					}
+					line = append(line, []byte(" "), bytes.TrimSpace(next))
+					ctx.SkipNext++
+				}
+				return append(line, []byte(fmt.Sprintf(" #%d\n", ctx.LineNum))), nil
+			},
+			window:   2,
+			expected: "HDR|a #1\nDAT|1 continued and more #2\nDAT|2 #5\nDAT|3 tail #6\nEOF #8\n",
+		},
+		{
+			name: "error",
+			edit: func(ctx *LineContext) ([][]byte, error) {
+				if ctx.LineNum == 3 {
+					return nil, fmt.Errorf("line %d at %d: mock error", ctx.LineNum, ctx.Offset)
+				}
+				return [][]byte{ctx.Line}, nil
+			},
+			err: "line 3 at 13: mock error",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, wrap := range []func(io.Reader) io.Reader{
+				func(r io.Reader) io.Reader { return r },
+				iotest.OneByteReader,
+				iotest.HalfReader,
+				iotest.DataErrReader,
+			} {
+				ret, err := ioutil.ReadAll(NewLineEditingReaderEx(wrap(strings.NewReader(input)), test.edit, test.window))
+				if test.err != "" {
+					assert.EqualError(t, err, test.err)
+					continue
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, string(ret))
+			}
+		})
+	}
+}
+
+func TestLineEditingReaderEx_Window(t *testing.T) {
+	var windows []string
+	_, err := ioutil.ReadAll(NewLineEditingReaderEx(iotest.OneByteReader(strings.NewReader("1\n2\n3\n4")),
+		func(ctx *LineContext) ([][]byte, error) {
+			windows = append(windows, fmt.Sprintf("%d:%q", ctx.LineNum, ctx.Next))
+			return [][]byte{ctx.Line}, nil
+		}, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`1:["2\n" "3\n"]`, `2:["3\n" "4"]`, `3:["4"]`, `4:[]`}, windows)
+
+	assert.PanicsWithValue(t, "window must be >= 0, instead got: -1", func() {
+		NewLineEditingReaderEx(strings.NewReader(""), nil, -1)
+	})
+	assert.PanicsWithValue(t, "SkipNext must be within [0, 1], instead got: 2", func() {
+		_, _ = ioutil.ReadAll(NewLineEditingReaderEx(strings.NewReader("1\n2\n"),
+			func(ctx *LineContext) ([][]byte, error) {
+				ctx.SkipNext = 2
+				return nil, nil
+			}, 1))
+	})
+}
+
+func TestLineEditingReader_Terminators(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		terminators []string
+		input       string
+		expected    string
+	}{
+		{
+			name:     "default",
+			input:    "a\rb\r\nc\n",
+			expected: "[a\rb\r\n][c\n]",
+		},
+		{
+			name:        "old mac",
+			terminators: []string{"\r"},
+			input:       "a\rb\r\nc\n",
+			expected:    "[a\r][b\r][\nc\n]",
+		},
+		{
+			name:        "crlf only",
+			terminators: []string{"\r\n"},
+			input:       "a\rb\r\nc\nd",
+			expected:    "[a\rb\r\n][c\nd]",
+		},
+		{
+			name:        "arbitrary sequence",
+			terminators: []string{"<EOL>"},
+			input:       "a<EO<EOL>b<EOL><EOL>",
+			expected:    "[a<EO<EOL>][b<EOL>][<EOL>]",
+		},
+		{
+			name:        "unicode",
+			terminators: UnicodeLineTerminators,
+			input:       "a\r\nb\rc\nd e f\u0085g\r",
+			expected:    "[a\r\n][b\r][c\n][d ][e ][f\u0085][g\r]",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, wrap := range []func(io.Reader) io.Reader{
+				func(r io.Reader) io.Reader { return r },
+				iotest.OneByteReader,
+				iotest.DataErrReader,
+			} {
+				r := NewLineEditingReader(wrap(strings.NewReader(test.input)), func(line []byte) ([]byte, error) {
+					return []byte("[" + string(line) + "]"), nil
+				}).SetOptions(LineEditingReaderOptions{Terminators: test.terminators})
+				ret, err := ioutil.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, string(ret))
+			}
+		})
+	}
+
+	assert.PanicsWithValue(t, "line terminator cannot be empty", func() {
+		NewLineEditingReader(strings.NewReader(""), nil).SetOptions(LineEditingReaderOptions{Terminators: []string{""}})
+	})
+	assert.PanicsWithValue(t, "line terminator cannot be empty", func() {
+		NewLineEditingReader(strings.NewReader(""), nil).SetOptions(
+			LineEditingReaderOptions{Terminators: []string{"\n", ""}})
+	})
+	assert.PanicsWithValue(t, "max line length must be >= 0, instead got: -1", func() {
+		NewLineEditingReader(strings.NewReader(""), nil).SetOptions(LineEditingReaderOptions{MaxLineLen: -1})
+	})
+}
+
+func TestLineEditingReader_MaxLineLen(t *testing.T) {
+	input := "12345\r\n123456\r\n1234567890\r\n\r\n12345678"
+	for _, test := range []struct {
+		name        string
+		lineTooLong LineTooLongPolicy
+		expected    string
+		err         string
+	}{
+		{
+			name:        "error",
+			lineTooLong: LineTooLongError,
+			expected:    "1:0:12345\r\n",
+			err:         "line 2 at offset 7 exceeds max line length 5",
+		},
+		{
+			name:        "truncate",
+			lineTooLong: LineTooLongTruncate,
+			expected:    "1:0:12345\r\n2:7:12345\r\n3:15:12345\r\n4:27:\r\n5:29:12345",
+		},
+		{
+			name:        "skip",
+			lineTooLong: LineTooLongSkip,
+			expected:    "1:0:12345\r\n4:27:\r\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, wrap := range []func(io.Reader) io.Reader{
+				func(r io.Reader) io.Reader { return r },
+				iotest.OneByteReader,
+				iotest.HalfReader,
+				iotest.DataErrReader,
+			} {
+				r := NewLineEditingReaderEx(wrap(strings.NewReader(input)), func(ctx *LineContext) ([][]byte, error) {
+					return ctx.Lines([]byte(fmt.Sprintf("%d:%d:", ctx.LineNum, ctx.Offset)), ctx.Line), nil
+				}, 0).SetOptions(LineEditingReaderOptions{
+					Terminators: []string{"\r\n", "\r"},
+					MaxLineLen:  5,
+					LineTooLong: test.lineTooLong,
+				})
+				ret, err := ioutil.ReadAll(r)
+				assert.Equal(t, test.expected, string(ret))
+				if test.err == "" {
+					assert.NoError(t, err)
+					continue
+				}
+				var errLineTooLong *ErrLineTooLong
+				assert.True(t, errors.As(err, &errLineTooLong))
+				assert.Equal(t, &ErrLineTooLong{LineNum: 2, Offset: 7, MaxLineLen: 5}, errLineTooLong)
+				assert.EqualError(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestLineEditingReader_MaxLineLen_Resume(t *testing.T) {
+	input := "12345\r\n123456\r\n1234567890\r\n\r\n12345678"
+	for _, wrap := range []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		iotest.OneByteReader,
+		iotest.HalfReader,
+		iotest.DataErrReader,
+	} {
+		r := NewLineEditingReaderEx(wrap(strings.NewReader(input)), func(ctx *LineContext) ([][]byte, error) {
+			return ctx.Lines([]byte(fmt.Sprintf("%d:%d:", ctx.LineNum, ctx.Offset)), ctx.Line), nil
+		}, 1).SetOptions(LineEditingReaderOptions{Terminators: []string{"\r\n", "\r"}, MaxLineLen: 5})
+		var ret []byte
+		var tooLong []int
+		for {
+			b, err := ioutil.ReadAll(r)
+			ret = append(ret, b...)
+			var errLineTooLong *ErrLineTooLong
+			if !errors.As(err, &errLineTooLong) {
+				assert.NoError(t, err)
+				break
+			}
+			// the same error until resumed.
+			_, err2 := r.Read(make([]byte, 10))
+			assert.Equal(t, err, err2)
+			tooLong = append(tooLong, errLineTooLong.LineNum)
+			// truncate the lines too long, except for the second one.
+			if len(tooLong) == 2 {
+				r.SkipLongLine()
+			} else {
+				r.TruncateLongLine()
+			}
+		}
+		assert.Equal(t, []int{2, 3, 5}, tooLong)
+		assert.Equal(t, "1:0:12345\r\n2:7:12345\r\n4:27:\r\n5:29:12345", string(ret))
+		assert.PanicsWithValue(t, "no line too long to resume from", func() { r.SkipLongLine() })
+	}
+
+	r := NewLineEditingReader(strings.NewReader("ab\nabcdef\nabc\n"), func(line []byte) ([]byte, error) {
+		return line, nil
+	}).SetOptions(LineEditingReaderOptions{MaxLineLen: 3})
+	ret, err := ioutil.ReadAll(r)
+	assert.Equal(t, "ab\n", string(ret))
+	assert.EqualError(t, err, "line 2 at offset 3 exceeds max line length 3")
+	r.TruncateLongLine()
+	ret, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc\nabc\n", string(ret))
+}
+
+type repeatReaderForTest struct {
+	b byte
+}
+
+func (r repeatReaderForTest) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.b
+	}
+	return len(p), nil
+}
+
+func TestLineEditingReader_MaxLineLen_BoundedBuf(t *testing.T) {
+	// a 64MB line without any terminator must not be held in memory.
+	input := io.MultiReader(
+		strings.NewReader("first\n"),
+		io.LimitReader(repeatReaderForTest{'x'}, 64*1024*1024),
+		strings.NewReader("\nlast"))
+	r := NewLineEditingReader(input, func(line []byte) ([]byte, error) { return line, nil }).
+		SetOptions(LineEditingReaderOptions{MaxLineLen: 4096, LineTooLong: LineTooLongTruncate})
+	ret, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n"+strings.Repeat("x", 4096)+"\nlast", string(ret))
+	assert.True(t, len(r.buf) <= 4096+2*defaultLineEditingReaderBufSize, "len(buf): %d", len(r.buf))
+
+	// same for the lines in the window.
+	r = NewLineEditingReaderEx(
+		io.MultiReader(strings.NewReader("first\n"), io.LimitReader(repeatReaderForTest{'x'}, 64*1024*1024)),
+		func(ctx *LineContext) ([][]byte, error) {
+			return ctx.Lines([]byte(fmt.Sprintf("%d:%d\n", ctx.LineNum, len(ctx.Next)))), nil
+		}, 3).SetOptions(LineEditingReaderOptions{MaxLineLen: 100, LineTooLong: LineTooLongSkip})
+	ret, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "1:0\n", string(ret))
+	assert.True(t, len(r.buf) <= 100+2*defaultLineEditingReaderBufSize, "len(buf): %d", len(r.buf))
+}
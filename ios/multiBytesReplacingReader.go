@@ -0,0 +1,220 @@
+package ios
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// MultiBytesReplacer is a BytesReplacer for multiple search:replace token pairs, backed by an
+// Aho-Corasick automaton, so that searching costs O(len(buf)) no matter how many search tokens there
+// are. When multiple search tokens match, the leftmost one wins; among those starting at the same
+// position, the longest one wins. A MultiBytesReplacer is immutable once created, so it can be shared
+// by multiple (and concurrent) BytesReplacingReader.
+type MultiBytesReplacer struct {
+	searches [][]byte
+	replaces [][]byte
+	// classes maps each byte to its equivalence class: 0 for bytes not in any search token, and
+	// 1..numClasses-1 for the others.
+	classes    [256]int32
+	numClasses int32
+	// states are identified by their offsets in delta, i.e. state number * numClasses, with 0 being
+	// the root. delta[state+class] is the state the automaton moves to, upon a byte of the class.
+	delta []int32
+	// out[state] is the index of the longest search token ending at the state, or -1 if none.
+	out []int32
+	// ext[state] is the length of the longest suffix of the state's bytes that can still be extended
+	// into a search token, i.e. how far back a match could start given more bytes.
+	ext []int32
+	// firstBytes tells the bytes search tokens start with; if they all start with the same byte,
+	// firstByte is it, otherwise -1. Used to skip quickly past the bytes that can't start a match.
+	firstBytes [256]bool
+	firstByte  int
+}
+
+// NewMultiBytesReplacer creates a MultiBytesReplacer replacing each key of replacements with its value.
+// replacements must have at least one search token; search tokens cannot be empty. Replace tokens can.
+func NewMultiBytesReplacer(replacements map[string]string) *MultiBytesReplacer {
+	if len(replacements) == 0 {
+		panic("replacements must have at least one search token")
+	}
+	searches := make([]string, 0, len(replacements))
+	for search := range replacements {
+		if search == "" {
+			panic("search token cannot be nil/empty")
+		}
+		searches = append(searches, search)
+	}
+	// deterministic state numbering, regardless of the map iteration order.
+	sort.Strings(searches)
+	m := &MultiBytesReplacer{}
+	for _, search := range searches {
+		m.searches = append(m.searches, []byte(search))
+		m.replaces = append(m.replaces, []byte(replacements[search]))
+	}
+	m.build()
+	return m
+}
+
+func (m *MultiBytesReplacer) build() {
+	m.numClasses = 1
+	m.firstByte = int(m.searches[0][0])
+	for _, search := range m.searches {
+		m.firstBytes[search[0]] = true
+		if int(search[0]) != m.firstByte {
+			m.firstByte = -1
+		}
+		for _, b := range search {
+			if m.classes[b] == 0 {
+				m.classes[b] = m.numClasses
+				m.numClasses++
+			}
+		}
+	}
+	// build the trie first: delta holds the trie edges only, -1 for no edge.
+	var depth []int32
+	var hasChildren []bool
+	newState := func(d int32) int32 {
+		for i := int32(0); i < m.numClasses; i++ {
+			m.delta = append(m.delta, -1)
+		}
+		m.out = append(m.out, -1)
+		depth = append(depth, d)
+		hasChildren = append(hasChildren, false)
+		return int32(len(m.out) - 1)
+	}
+	newState(0)
+	for i, search := range m.searches {
+		state := int32(0)
+		for _, b := range search {
+			edge := state*m.numClasses + m.classes[b]
+			if m.delta[edge] < 0 {
+				next := newState(depth[state] + 1)
+				m.delta[edge] = next
+				hasChildren[state] = true
+			}
+			state = m.delta[edge]
+		}
+		m.out[state] = int32(i)
+	}
+	// then turn the trie into a DFA, in BFS order so the failure state of each state, being shallower,
+	// is done before the state itself.
+	fail := make([]int32, len(m.out))
+	m.ext = make([]int32, len(m.out))
+	queue := []int32{0}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		if state != 0 {
+			if m.out[state] < 0 {
+				m.out[state] = m.out[fail[state]]
+			}
+			m.ext[state] = m.ext[fail[state]]
+			if hasChildren[state] {
+				m.ext[state] = depth[state]
+			}
+		}
+		for c := int32(0); c < m.numClasses; c++ {
+			next := m.delta[state*m.numClasses+c]
+			switch {
+			case next >= 0:
+				if state != 0 {
+					fail[next] = m.delta[fail[state]*m.numClasses+c]
+				}
+				queue = append(queue, next)
+			case state == 0:
+				m.delta[c] = 0
+			default:
+				m.delta[state*m.numClasses+c] = m.delta[fail[state]*m.numClasses+c]
+			}
+		}
+	}
+	// finally switch from state numbers to state offsets.
+	numStates := int32(len(m.out))
+	out, ext := m.out, m.ext
+	m.out = make([]int32, numStates*m.numClasses)
+	m.ext = make([]int32, numStates*m.numClasses)
+	for state := int32(0); state < numStates; state++ {
+		m.out[state*m.numClasses] = out[state]
+		m.ext[state*m.numClasses] = ext[state]
+	}
+	for i := range m.delta {
+		m.delta[i] *= m.numClasses
+	}
+}
+
+// GetSizingHints implements BytesReplacer.
+func (m *MultiBytesReplacer) GetSizingHints() (int, int, float64) {
+	maxSearchLen := 0
+	maxReplaceLen := 0
+	ratio := float64(-1)
+	for i := range m.searches {
+		searchLen := len(m.searches[i])
+		replaceLen := len(m.replaces[i])
+		maxSearchLen = max(maxSearchLen, searchLen)
+		maxReplaceLen = max(maxReplaceLen, replaceLen)
+		// the worst case is the search token expanding the most.
+		if searchLen < replaceLen && (ratio < 0 || float64(searchLen)/float64(replaceLen) < ratio) {
+			ratio = float64(searchLen) / float64(replaceLen)
+		}
+	}
+	return maxSearchLen, maxReplaceLen, ratio
+}
+
+// Index implements BytesReplacer.
+func (m *MultiBytesReplacer) Index(buf []byte) (int, []byte, []byte) {
+	index, search, replace, _ := m.IndexEx(buf, true)
+	return index, search, replace
+}
+
+// IndexEx implements BytesReplacerEx.
+func (m *MultiBytesReplacer) IndexEx(buf []byte, atEOF bool) (int, []byte, []byte, error) {
+	state := int32(0)
+	best, bestStart := int32(-1), 0
+	for i := 0; i < len(buf); i++ {
+		if state == 0 && best < 0 {
+			if i = m.skip(buf, i); i < 0 {
+				return -1, nil, nil, nil
+			}
+		}
+		state = m.delta[state+m.classes[buf[i]]]
+		if found := m.out[state]; found >= 0 {
+			// matches are found in order of their ends; a later one wins if it starts no later.
+			if start := i + 1 - len(m.searches[found]); best < 0 || start <= bestStart {
+				best, bestStart = found, start
+			}
+		}
+		if best >= 0 && i+1-int(m.ext[state]) > bestStart {
+			// no more bytes can make a match starting at or before bestStart.
+			return bestStart, m.searches[best], m.replaces[best], nil
+		}
+	}
+	if best < 0 || (!atEOF && len(buf)-int(m.ext[state]) <= bestStart) {
+		return -1, nil, nil, nil
+	}
+	return bestStart, m.searches[best], m.replaces[best], nil
+}
+
+// skip returns the index of the first byte at or after buf[i] that a search token starts with, or -1
+// if none.
+func (m *MultiBytesReplacer) skip(buf []byte, i int) int {
+	if m.firstByte >= 0 {
+		if j := bytes.IndexByte(buf[i:], byte(m.firstByte)); j >= 0 {
+			return i + j
+		}
+		return -1
+	}
+	for ; i < len(buf); i++ {
+		if m.firstBytes[buf[i]] {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewMultiBytesReplacingReader creates a new `*BytesReplacingReader` replacing each key of replacements
+// with its value, using a MultiBytesReplacer. To reuse the Aho-Corasick automaton across readers,
+// create the MultiBytesReplacer once by NewMultiBytesReplacer, and use NewBytesReplacingReaderEx instead.
+func NewMultiBytesReplacingReader(r io.Reader, replacements map[string]string) *BytesReplacingReader {
+	return NewBytesReplacingReaderEx(r, NewMultiBytesReplacer(replacements))
+}
@@ -0,0 +1,268 @@
+package ios
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiBytesReplacingReader(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		input        string
+		replacements map[string]string
+		expected     string
+	}{
+		{
+			name:         "no match",
+			input:        "hello world",
+			replacements: map[string]string{"abc": "x", "xyz": "y"},
+			expected:     "hello world",
+		},
+		{
+			name:         "multiple tokens",
+			input:        "abcdefgop01234qrstuvwxyz",
+			replacements: map[string]string{"abc": "one two three", "12": "twelve is an int", "st": "", "xyz": "uv"},
+			expected:     "one two threedefgop0twelve is an int34qruvwuv",
+		},
+		{
+			name:         "leftmost wins",
+			input:        "abcd",
+			replacements: map[string]string{"bcd": "1", "ab": "2"},
+			expected:     "2cd",
+		},
+		{
+			name:         "longest wins among the leftmost",
+			input:        "he said she sells",
+			replacements: map[string]string{"he": "1", "hers": "2", "she": "3", "s": "4", "sells": "5"},
+			expected:     "1 4aid 3 5",
+		},
+		{
+			name:         "longer token found later, starting earlier",
+			input:        "xabcdx",
+			replacements: map[string]string{"bc": "1", "abcd": "2"},
+			expected:     "x2x",
+		},
+		{
+			name:         "a longer token sharing prefix, not matching",
+			input:        "abcabx",
+			replacements: map[string]string{"ab": "1", "abcabd": "2"},
+			expected:     "1c1x",
+		},
+		{
+			name:         "longest token at the end of the input",
+			input:        "aaaab",
+			replacements: map[string]string{"a": "1", "aab": "2"},
+			expected:     "112",
+		},
+		{
+			name:         "replacements not re-scanned",
+			input:        "aaa",
+			replacements: map[string]string{"a": "aa"},
+			expected:     "aaaaaa",
+		},
+		{
+			name:         "escaping",
+			input:        `<a href="x">&</a>`,
+			replacements: map[string]string{"<": "&lt;", ">": "&gt;", "&": "&amp;", `"`: "&quot;"},
+			expected:     "&lt;a href=&quot;x&quot;&gt;&amp;&lt;/a&gt;",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, wrap := range []func(io.Reader) io.Reader{
+				func(r io.Reader) io.Reader { return r },
+				iotest.OneByteReader,
+				iotest.HalfReader,
+				iotest.DataErrReader,
+			} {
+				r := NewMultiBytesReplacingReader(wrap(strings.NewReader(test.input)), test.replacements)
+				result, err := ioutil.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, string(result))
+			}
+		})
+	}
+
+	assert.PanicsWithValue(t, "replacements must have at least one search token", func() {
+		NewMultiBytesReplacingReader(strings.NewReader("test"), nil)
+	})
+	assert.PanicsWithValue(t, "search token cannot be nil/empty", func() {
+		NewMultiBytesReplacingReader(strings.NewReader("test"), map[string]string{"": "x"})
+	})
+}
+
+func TestMultiBytesReplacer_GetSizingHints(t *testing.T) {
+	maxSearchLen, maxReplaceLen, ratio := NewMultiBytesReplacer(
+		map[string]string{"abc": "", "a": "xyz", "ab": "xyz", "abcd": "x"}).GetSizingHints()
+	assert.Equal(t, 4, maxSearchLen)
+	assert.Equal(t, 3, maxReplaceLen)
+	assert.Equal(t, float64(1)/3, ratio)
+
+	_, _, ratio = NewMultiBytesReplacer(map[string]string{"abc": "x"}).GetSizingHints()
+	assert.Equal(t, float64(-1), ratio)
+}
+
+// replaceLeftmostLongestForTest is the naive reference implementation of MultiBytesReplacer.
+func replaceLeftmostLongestForTest(input []byte, replacements map[string]string) []byte {
+	var out []byte
+	for i := 0; i < len(input); {
+		longest := ""
+		for search := range replacements {
+			if len(search) > len(longest) && bytes.HasPrefix(input[i:], []byte(search)) {
+				longest = search
+			}
+		}
+		if longest == "" {
+			out = append(out, input[i])
+			i++
+			continue
+		}
+		out = append(out, replacements[longest]...)
+		i += len(longest)
+	}
+	return out
+}
+
+type chunkReaderForTest struct {
+	r   io.Reader
+	rnd *rand.Rand
+}
+
+func (r *chunkReaderForTest) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1+r.rnd.Intn(len(p)-1)]
+	}
+	return r.r.Read(p)
+}
+
+func TestMultiBytesReplacingReader_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	randBytes := func(n int, alphabet string) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		return string(b)
+	}
+	for i := 0; i < 200; i++ {
+		replacements := make(map[string]string)
+		for j := 0; j < 1+rnd.Intn(10); j++ {
+			replacements[randBytes(1+rnd.Intn(6), "abc")] = randBytes(rnd.Intn(8), "xyz")
+		}
+		input := []byte(randBytes(rnd.Intn(10000), "abcd"))
+		expected := replaceLeftmostLongestForTest(input, replacements)
+		r := NewMultiBytesReplacingReader(&chunkReaderForTest{r: bytes.NewReader(input), rnd: rnd}, replacements)
+		var result []byte
+		buf := make([]byte, 1+rnd.Intn(100))
+		for {
+			n, err := r.Read(buf)
+			result = append(result, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+		}
+		if !assert.Equal(t, string(expected), string(result), "replacements: %v", replacements) {
+			return
+		}
+	}
+}
+
+func TestMultiBytesReplacingReader_LongSearchTokenWithHighExpansion(t *testing.T) {
+	// the read bound derived from the expansion of "a" must still leave room for the long token.
+	long := strings.Repeat("x", 5000)
+	input := "a" + long + "a"
+	r := NewMultiBytesReplacingReader(strings.NewReader(input),
+		map[string]string{"a": strings.Repeat("b", 100), long: "y"})
+	result, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("b", 100)+"y"+strings.Repeat("b", 100), string(result))
+}
+
+func createMultiTokenTestInput(length int, searches []string, numTargets int) []byte {
+	rnd := rand.New(rand.NewSource(1234)) // fixed rand seed to ensure bench stability
+	b := make([]byte, 0, length)
+	for len(b) < length {
+		if rnd.Intn(length/numTargets+1) == 0 {
+			b = append(b, searches[rnd.Intn(len(searches))]...)
+			continue
+		}
+		b = append(b, byte('a'+rnd.Intn(26)))
+	}
+	return b
+}
+
+func createBenchReplacements(n int, words bool) (map[string]string, []string) {
+	rnd := rand.New(rand.NewSource(1234))
+	replacements := make(map[string]string, n)
+	var searches []string
+	for len(searches) < n {
+		search := fmt.Sprintf("<tok%d>", len(searches))
+		if words {
+			// lowercase words, same as the input, so the automaton can't skip much.
+			word := make([]byte, 4+rnd.Intn(5))
+			for j := range word {
+				word[j] = byte('a' + rnd.Intn(26))
+			}
+			search = string(word)
+			if _, dup := replacements[search]; dup {
+				continue
+			}
+		}
+		replacements[search] = fmt.Sprintf("[%d]", len(searches))
+		searches = append(searches, search)
+	}
+	return replacements, searches
+}
+
+func benchmarkMultiReplacer(b *testing.B, numTokens int, words, naive bool) {
+	replacements, searches := createBenchReplacements(numTokens, words)
+	input := createMultiTokenTestInput(1024*1024, searches, 1000)
+	var replacer BytesReplacer = NewMultiBytesReplacer(replacements)
+	if naive {
+		naiveReplacer := &multiTokenReplacer{}
+		for _, search := range searches {
+			naiveReplacer.searches = append(naiveReplacer.searches, []byte(search))
+			naiveReplacer.replaces = append(naiveReplacer.replaces, []byte(replacements[search]))
+		}
+		replacer = naiveReplacer
+	}
+	r := &BytesReplacingReader{}
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ResetEx(bytes.NewReader(input), replacer)
+		_, _ = ioutil.ReadAll(r)
+	}
+}
+
+func BenchmarkMultiBytesReplacingReader_1MBLength_10Tokens(b *testing.B) {
+	benchmarkMultiReplacer(b, 10, false, false)
+}
+
+func BenchmarkNaiveMultiTokenReplacingReader_1MBLength_10Tokens(b *testing.B) {
+	benchmarkMultiReplacer(b, 10, false, true)
+}
+
+func BenchmarkMultiBytesReplacingReader_1MBLength_500Tokens(b *testing.B) {
+	benchmarkMultiReplacer(b, 500, false, false)
+}
+
+func BenchmarkNaiveMultiTokenReplacingReader_1MBLength_500Tokens(b *testing.B) {
+	benchmarkMultiReplacer(b, 500, false, true)
+}
+
+func BenchmarkMultiBytesReplacingReader_1MBLength_500Words(b *testing.B) {
+	benchmarkMultiReplacer(b, 500, true, false)
+}
+
+func BenchmarkNaiveMultiTokenReplacingReader_1MBLength_500Words(b *testing.B) {
+	benchmarkMultiReplacer(b, 500, true, true)
+}
@@ -0,0 +1,57 @@
+package ios
+
+import "sort"
+
+// offsetMap maps output offsets back to input offsets, for BytesReplacingReader/Writer. It's a run-length
+// list of (output offset, delta) entries, sorted by output offset: the bytes at and after an entry's
+// output offset, up to the next entry's, are at (output offset + delta) in the input. An entry is only
+// added when the delta changes, so the map grows with the replacements changing lengths only.
+type offsetMap struct {
+	entries []offsetMapEntry
+}
+
+type offsetMapEntry struct {
+	output, delta int64
+}
+
+// add records a replacement of search token at inputOffset with replace token at outputOffset. Up to
+// the replacement, the delta is unchanged; the replace token maps onto the search token byte by byte,
+// clamped to the search token's last byte if the replace token is longer (see inputOffset). So only
+// the delta after the replacement is recorded.
+func (m *offsetMap) add(inputOffset, outputOffset int64, searchLen, replaceLen int) {
+	output := outputOffset + int64(replaceLen)
+	delta := inputOffset + int64(searchLen) - output
+	n := len(m.entries)
+	if (n == 0 && delta == 0) || (n > 0 && m.entries[n-1].delta == delta) {
+		return
+	}
+	// with adjacent deletions, multiple entries can be at the same output offset: only the first one
+	// (for clamping the bytes before it) and the last one (for the bytes after it) are needed.
+	if n >= 2 && m.entries[n-1].output == output && m.entries[n-2].output == output {
+		m.entries[n-1].delta = delta
+		return
+	}
+	m.entries = append(m.entries, offsetMapEntry{output: output, delta: delta})
+}
+
+// inputOffset returns the input offset of the byte at the output offset.
+func (m *offsetMap) inputOffset(output int64) int64 {
+	// index of the first entry after output.
+	i := sort.Search(len(m.entries), func(i int) bool { return m.entries[i].output > output })
+	input := output
+	if i > 0 {
+		input += m.entries[i-1].delta
+	}
+	if i < len(m.entries) {
+		// within a replace token longer than its search token, clamp to the last byte of the search token.
+		next := m.entries[i]
+		if limit := next.output + next.delta - 1; input > limit {
+			input = limit
+		}
+	}
+	return input
+}
+
+func (m *offsetMap) reset() {
+	m.entries = m.entries[:0]
+}
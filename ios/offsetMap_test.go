@@ -0,0 +1,119 @@
+package ios
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetMap(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		input        string
+		replacements map[string]string
+		output       string
+		// expected[i] is the input offset of output[i], plus one for the end of the output.
+		expected []int64
+		entries  int
+	}{
+		{
+			name:         "no replacement",
+			input:        "abc",
+			replacements: map[string]string{"x": "y"},
+			output:       "abc",
+			expected:     []int64{0, 1, 2, 3},
+			entries:      0,
+		},
+		{
+			name:         "same length replacements",
+			input:        "abcb",
+			replacements: map[string]string{"b": "x"},
+			output:       "axcx",
+			expected:     []int64{0, 1, 2, 3, 4},
+			entries:      0,
+		},
+		{
+			name:         "longer replace token",
+			input:        "abc",
+			replacements: map[string]string{"b": "XYZ"},
+			output:       "aXYZc",
+			expected:     []int64{0, 1, 1, 1, 2, 3},
+			entries:      1,
+		},
+		{
+			name:         "shorter replace token",
+			input:        "abcde",
+			replacements: map[string]string{"bcd": "XY"},
+			output:       "aXYe",
+			expected:     []int64{0, 1, 2, 4, 5},
+			entries:      1,
+		},
+		{
+			name:         "deletions",
+			input:        "\x00a\x00\x00b\x00",
+			replacements: map[string]string{"\x00": ""},
+			output:       "ab",
+			expected:     []int64{1, 4, 6},
+			entries:      4,
+		},
+		{
+			name:         "adjacent replacements",
+			input:        "abab",
+			replacements: map[string]string{"a": "123", "b": ""},
+			output:       "123123",
+			expected:     []int64{0, 0, 0, 2, 2, 2, 4},
+			entries:      4,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewMultiBytesReplacingReader(strings.NewReader(test.input), test.replacements).EnableOffsetMap(true)
+			output, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, string(output))
+			var actual []int64
+			for i := int64(0); i <= int64(len(output)); i++ {
+				actual = append(actual, r.InputOffset(i))
+			}
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.entries, len(r.offsets.entries))
+		})
+	}
+
+	r := NewBytesReplacingReader(strings.NewReader("abc"), []byte("b"), nil)
+	assert.PanicsWithValue(t, "offset map not enabled", func() { r.InputOffset(0) })
+}
+
+func TestOffsetMap_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	r := &BytesReplacingReader{}
+	r.EnableOffsetMap(true)
+	for i := 0; i < 100; i++ {
+		input := make([]byte, rnd.Intn(10000))
+		for j := range input {
+			input[j] = "abcd"[rnd.Intn(4)]
+		}
+		replacements := map[string]string{"ab": "x", "c": "yyyy", "dd": ""}
+		var observed []Replacement
+		r.ResetEx(&chunkReaderForTest{r: bytes.NewReader(input), rnd: rnd}, NewMultiBytesReplacer(replacements))
+		r.SetObserver(func(rep Replacement) { observed = append(observed, rep) })
+		output, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		// the bytes outside of the replace tokens map to the same bytes in the input.
+		inReplace := make([]bool, len(output))
+		for _, rep := range observed {
+			for j := 0; j < len(replacements[string(rep.Search)]); j++ {
+				inReplace[rep.OutputOffset+int64(j)] = true
+			}
+		}
+		for j := range output {
+			if !inReplace[j] && !assert.Equal(t, output[j], input[r.InputOffset(int64(j))]) {
+				return
+			}
+		}
+		assert.Equal(t, int64(len(input)), r.InputOffset(int64(len(output))))
+	}
+}
@@ -0,0 +1,289 @@
+package ios
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ParallelLineEditingReaderOptions customizes ParallelLineEditingReader. Zero values mean the defaults.
+type ParallelLineEditingReaderOptions struct {
+	// Workers is the number of goroutines editing lines; defaults to runtime.GOMAXPROCS(0).
+	Workers int
+	// BatchSize is the number of bytes of lines handed to a worker at a time; a batch can be bigger if
+	// it has a line longer than BatchSize. Defaults to 64KB.
+	BatchSize int
+	// MaxInFlight is the max number of batches read in but not yet returned by Read, which bounds the
+	// memory used to about MaxInFlight * (BatchSize + MaxLineLen). Defaults to 2 * Workers.
+	MaxInFlight int
+	// MaxLineLen is the max length of a line, excluding its '\n'. Defaults to 1MB.
+	MaxLineLen int
+	// LineTooLong tells what to do with a line longer than MaxLineLen. Unlike LineEditingReader, an
+	// *ErrLineTooLong stops the reading for good, as the lines after it are already being edited.
+	LineTooLong LineTooLongPolicy
+}
+
+const (
+	defaultParallelLineEditingBatchSize  = 64 * 1024
+	defaultParallelLineEditingMaxLineLen = 1024 * 1024
+)
+
+// ErrReaderClosed is returned by ParallelLineEditingReader upon Read after Close.
+var ErrReaderClosed = errors.New("read from closed ParallelLineEditingReader")
+
+// ParallelLineEditingReader is a LineEditingReader running the LineEditFunc on a pool of goroutines:
+// the input is split into batches of lines, edited concurrently, and the edited batches are returned
+// by Read in the original order. Upon an edit error, Read returns all the edited lines before the line
+// failed, then the error. The LineEditFunc must be safe for concurrent use. Lines are defined as in
+// LineEditingReader, i.e. ending with '\n'.
+//
+// If the reader isn't read till the end (or an error), Close must be called to stop the goroutines.
+type ParallelLineEditingReader struct {
+	r    io.Reader
+	edit LineEditFunc
+	opts ParallelLineEditingReaderOptions
+
+	started bool
+	// jobs: batches for workers to edit; ordered: the same batches in input order, for Read.
+	jobs    chan *lineBatch
+	ordered chan *lineBatch
+	// slots limits the batches in flight; free recycles them.
+	slots    chan struct{}
+	free     chan *lineBatch
+	quit     chan struct{}
+	quitOnce sync.Once
+	// readErr is the error from r, set by the producer goroutine before closing ordered.
+	readErr error
+
+	cur *lineBatch
+	pos int
+	err error
+}
+
+type lineBatch struct {
+	in  []byte
+	out []byte
+	// lineNum and offset are the number of lines and bytes before the batch in the input, for
+	// ErrLineTooLong. Only kept with LineTooLongError, as the bytes of the lines too long dropped by
+	// the producer would throw them off otherwise.
+	lineNum int
+	offset  int64
+	err     error
+	done    chan struct{}
+}
+
+// NewParallelLineEditingReader creates a new ParallelLineEditingReader.
+func NewParallelLineEditingReader(
+	r io.Reader, edit LineEditFunc, opts ParallelLineEditingReaderOptions) *ParallelLineEditingReader {
+	if opts.Workers < 0 || opts.BatchSize < 0 || opts.MaxInFlight < 0 || opts.MaxLineLen < 0 {
+		panic(fmt.Sprintf("options cannot be negative, instead got: %+v", opts))
+	}
+	if opts.Workers == 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultParallelLineEditingBatchSize
+	}
+	if opts.MaxInFlight == 0 {
+		opts.MaxInFlight = 2 * opts.Workers
+	}
+	if opts.MaxLineLen == 0 {
+		opts.MaxLineLen = defaultParallelLineEditingMaxLineLen
+	}
+	return &ParallelLineEditingReader{r: r, edit: edit, opts: opts}
+}
+
+func (r *ParallelLineEditingReader) start() {
+	r.started = true
+	r.jobs = make(chan *lineBatch)
+	r.ordered = make(chan *lineBatch, r.opts.MaxInFlight)
+	r.slots = make(chan struct{}, r.opts.MaxInFlight)
+	r.free = make(chan *lineBatch, r.opts.MaxInFlight)
+	r.quit = make(chan struct{})
+	for i := 0; i < r.opts.Workers; i++ {
+		go r.work()
+	}
+	go r.produce()
+}
+
+// produce reads the input into batches of lines, and hands them to the workers and Read.
+func (r *ParallelLineEditingReader) produce() {
+	defer close(r.ordered)
+	defer close(r.jobs)
+	var carry []byte
+	// discarding tells the bytes of the last line, too long, are being dropped till its '\n'.
+	discarding := false
+	lineNum, offset := 0, int64(0)
+	for {
+		select {
+		case r.slots <- struct{}{}:
+		case <-r.quit:
+			return
+		}
+		b := r.newBatch()
+		b.lineNum, b.offset = lineNum, offset
+		b.in = append(b.in, carry...)
+		var err error
+		hasLF := bytes.IndexByte(b.in, '\n') >= 0
+		for err == nil && (len(b.in) < r.opts.BatchSize || !hasLF) {
+			if cap(b.in)-len(b.in) <= r.opts.BatchSize/4 {
+				// only with a line longer than BatchSize; the line is capped by capLongLine.
+				b.in = append(b.in[:cap(b.in)], make([]byte, cap(b.in))...)[:len(b.in)]
+			}
+			from := len(b.in)
+			var n int
+			n, err = r.r.Read(b.in[from:cap(b.in)])
+			b.in, discarding = r.capLongLine(b.in[:from+n], from, discarding)
+			hasLF = hasLF || bytes.IndexByte(b.in[from:], '\n') >= 0
+		}
+		cut := len(b.in)
+		if err != io.EOF {
+			// only complete lines are edited, unless at the end of the input; same as LineEditingReader.
+			cut = bytes.LastIndexByte(b.in, '\n') + 1
+		}
+		carry = append(carry[:0], b.in[cut:]...)
+		b.in = b.in[:cut]
+		if r.opts.LineTooLong == LineTooLongError {
+			lineNum += bytes.Count(b.in, []byte{'\n'})
+			offset += int64(len(b.in))
+		}
+		select {
+		case r.jobs <- b:
+		case <-r.quit:
+			return
+		}
+		// never blocks, as ordered has room for all the batches in flight.
+		r.ordered <- b
+		if err != nil {
+			r.readErr = err
+			return
+		}
+	}
+}
+
+// capLongLine caps the last line of in, of which in[from:] is just read in, at MaxLineLen+1 bytes,
+// enough for the workers to tell it's too long, by dropping the rest of the line till its '\n'.
+func (r *ParallelLineEditingReader) capLongLine(in []byte, from int, discarding bool) ([]byte, bool) {
+	for {
+		if discarding {
+			i := bytes.IndexByte(in[from:], '\n')
+			if i < 0 {
+				return in[:from], true
+			}
+			in = in[:from+copy(in[from:], in[from+i:])]
+			discarding = false
+		}
+		lineStart := bytes.LastIndexByte(in, '\n') + 1
+		if len(in)-lineStart <= r.opts.MaxLineLen+1 {
+			return in, false
+		}
+		from, discarding = lineStart+r.opts.MaxLineLen+1, true
+	}
+}
+
+func (r *ParallelLineEditingReader) newBatch() *lineBatch {
+	select {
+	case b := <-r.free:
+		b.in, b.out, b.err, b.done = b.in[:0], b.out[:0], nil, make(chan struct{})
+		return b
+	default:
+		return &lineBatch{in: make([]byte, 0, r.opts.BatchSize+r.opts.BatchSize/4), done: make(chan struct{})}
+	}
+}
+
+func (r *ParallelLineEditingReader) work() {
+	for b := range r.jobs {
+		lineNum, offset := b.lineNum, b.offset
+		for in := b.in; len(in) > 0; {
+			lineLen := bytes.IndexByte(in, '\n') + 1
+			if lineLen == 0 {
+				lineLen = len(in)
+			}
+			line := in[:lineLen]
+			in = in[lineLen:]
+			lineNum++
+			if contentLen := len(bytes.TrimSuffix(line, []byte{'\n'})); contentLen > r.opts.MaxLineLen {
+				if r.opts.LineTooLong == LineTooLongError {
+					b.err = &ErrLineTooLong{LineNum: lineNum, Offset: offset, MaxLineLen: r.opts.MaxLineLen}
+					break
+				}
+				if r.opts.LineTooLong == LineTooLongSkip {
+					continue
+				}
+				// truncated in place, keeping the '\n', if any.
+				copy(line[r.opts.MaxLineLen:], line[contentLen:])
+				line = line[:r.opts.MaxLineLen+len(line)-contentLen]
+			}
+			offset += int64(lineLen)
+			edited, err := r.edit(line)
+			if err != nil {
+				b.err = err
+				break
+			}
+			b.out = append(b.out, edited...)
+		}
+		close(b.done)
+	}
+}
+
+// Read implements io.Reader interface for ParallelLineEditingReader.
+func (r *ParallelLineEditingReader) Read(p []byte) (int, error) {
+	if !r.started && r.err == nil {
+		r.start()
+	}
+	for {
+		if r.cur != nil {
+			if r.pos < len(r.cur.out) {
+				n := copy(p, r.cur.out[r.pos:])
+				r.pos += n
+				return n, nil
+			}
+			if r.cur.err != nil {
+				r.err = r.cur.err
+				r.stop()
+			}
+			r.release(r.cur)
+			r.cur = nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		b, ok := <-r.ordered
+		if !ok {
+			r.err = r.readErr
+			continue
+		}
+		<-b.done
+		r.cur, r.pos = b, 0
+	}
+}
+
+func (r *ParallelLineEditingReader) release(b *lineBatch) {
+	select {
+	case r.free <- b:
+	default:
+	}
+	<-r.slots
+}
+
+func (r *ParallelLineEditingReader) stop() {
+	r.quitOnce.Do(func() {
+		if r.quit != nil {
+			close(r.quit)
+		}
+	})
+}
+
+// Close stops the goroutines, and makes all subsequent Read calls fail. It doesn't close the underlying
+// io.Reader.
+func (r *ParallelLineEditingReader) Close() error {
+	r.stop()
+	r.cur = nil
+	if r.err == nil {
+		r.err = ErrReaderClosed
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package ios
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parallelEditForTest(line []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(line, []byte("d")):
+		return line[:0], nil
+	case bytes.HasPrefix(line, []byte("e")):
+		return append([]byte("<expanded>"), line...), nil
+	case len(line) > 0:
+		line[0] = 'X'
+	}
+	return line, nil
+}
+
+func TestParallelLineEditingReader(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for i := 0; i < 100; i++ {
+		var sb strings.Builder
+		for j := rnd.Intn(1000); j > 0; j-- {
+			sb.WriteString(strings.Repeat(string("abde"[rnd.Intn(4)]), rnd.Intn(50)))
+			sb.WriteByte('\n')
+		}
+		if rnd.Intn(2) == 0 {
+			sb.WriteString("last line without LF")
+		}
+		input := sb.String()
+		expected, err := ioutil.ReadAll(NewLineEditingReader(strings.NewReader(input), parallelEditForTest))
+		assert.NoError(t, err)
+		opts := ParallelLineEditingReaderOptions{
+			Workers:     rnd.Intn(8),
+			BatchSize:   rnd.Intn(200),
+			MaxInFlight: rnd.Intn(5),
+		}
+		r := NewParallelLineEditingReader(
+			&chunkReaderForTest{r: strings.NewReader(input), rnd: rnd}, parallelEditForTest, opts)
+		actual, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		if !assert.Equal(t, string(expected), string(actual), "opts: %+v", opts) {
+			return
+		}
+		assert.NoError(t, r.Close())
+	}
+
+	assert.PanicsWithValue(t, "options cannot be negative, instead got: {Workers:0 BatchSize:-1 MaxInFlight:0 MaxLineLen:0 LineTooLong:0}",
+		func() {
+			NewParallelLineEditingReader(strings.NewReader(""), nil, ParallelLineEditingReaderOptions{BatchSize: -1})
+		})
+}
+
+func TestParallelLineEditingReader_MaxLineLen(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for i := 0; i < 300; i++ {
+		var sb strings.Builder
+		for j := rnd.Intn(200); j > 0; j-- {
+			sb.WriteString(strings.Repeat(string("abde"[rnd.Intn(4)]), rnd.Intn(100)))
+			sb.WriteByte('\n')
+		}
+		if rnd.Intn(2) == 0 {
+			sb.WriteString(strings.Repeat("z", rnd.Intn(100)))
+		}
+		input := sb.String()
+		maxLineLen := 1 + rnd.Intn(60)
+		policy := LineTooLongPolicy(rnd.Intn(3))
+		expected, expectedErr := ioutil.ReadAll(
+			NewLineEditingReader(strings.NewReader(input), parallelEditForTest).
+				SetOptions(LineEditingReaderOptions{MaxLineLen: maxLineLen, LineTooLong: policy}))
+		opts := ParallelLineEditingReaderOptions{
+			Workers:     1 + rnd.Intn(4),
+			BatchSize:   1 + rnd.Intn(200),
+			MaxInFlight: rnd.Intn(5),
+			MaxLineLen:  maxLineLen,
+			LineTooLong: policy,
+		}
+		// the producer goroutine might still be reading after an error, so it has its own rand.
+		chunkRnd := rand.New(rand.NewSource(rnd.Int63()))
+		actual, err := ioutil.ReadAll(NewParallelLineEditingReader(
+			&chunkReaderForTest{r: strings.NewReader(input), rnd: chunkRnd}, parallelEditForTest, opts))
+		if !assert.Equal(t, expectedErr, err, "opts: %+v", opts) ||
+			!assert.Equal(t, string(expected), string(actual), "opts: %+v", opts) {
+			return
+		}
+	}
+}
+
+func TestParallelLineEditingReader_MaxLineLen_BoundedBatch(t *testing.T) {
+	for _, policy := range []LineTooLongPolicy{LineTooLongTruncate, LineTooLongSkip, LineTooLongError} {
+		// a 64MB line without any '\n' must not be held in memory.
+		input := io.MultiReader(
+			strings.NewReader("first\n"),
+			io.LimitReader(repeatReaderForTest{'x'}, 64*1024*1024),
+			strings.NewReader("\nlast"))
+		r := NewParallelLineEditingReader(input, func(line []byte) ([]byte, error) { return line, nil },
+			ParallelLineEditingReaderOptions{BatchSize: 1000, MaxLineLen: 4096, LineTooLong: policy})
+		ret, err := ioutil.ReadAll(r)
+		switch policy {
+		case LineTooLongTruncate:
+			assert.NoError(t, err)
+			assert.Equal(t, "first\n"+strings.Repeat("x", 4096)+"\nlast", string(ret))
+		case LineTooLongSkip:
+			assert.NoError(t, err)
+			assert.Equal(t, "first\nlast", string(ret))
+		default:
+			assert.Equal(t, &ErrLineTooLong{LineNum: 2, Offset: 6, MaxLineLen: 4096}, err)
+			assert.Equal(t, "first\n", string(ret))
+		}
+		assert.NoError(t, r.Close())
+		for len(r.free) > 0 {
+			b := <-r.free
+			assert.True(t, cap(b.in) <= 4*(1000+4096), "cap: %d", cap(b.in))
+		}
+	}
+}
+
+func TestParallelLineEditingReader_EditError(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&input, "%d\n", i)
+	}
+	var edited int32
+	r := NewParallelLineEditingReader(strings.NewReader(input.String()), func(line []byte) ([]byte, error) {
+		atomic.AddInt32(&edited, 1)
+		if string(line) == "5000\n" {
+			return nil, errors.New("boom at 5000")
+		}
+		return line, nil
+	}, ParallelLineEditingReaderOptions{Workers: 4, BatchSize: 100})
+	ret, err := ioutil.ReadAll(r)
+	assert.EqualError(t, err, "boom at 5000")
+	assert.Equal(t, input.String()[:strings.Index(input.String(), "5000\n")], string(ret))
+	_, err = r.Read(make([]byte, 10))
+	assert.EqualError(t, err, "boom at 5000")
+	// the stream is stopped: not all the lines are edited.
+	assert.True(t, atomic.LoadInt32(&edited) < 10000)
+	assert.NoError(t, r.Close())
+}
+
+func TestParallelLineEditingReader_ReadError(t *testing.T) {
+	input := "line 1\nline 2\npartial"
+	expected, err := ioutil.ReadAll(
+		NewLineEditingReader(iotest.TimeoutReader(strings.NewReader(input)), parallelEditForTest))
+	assert.Equal(t, iotest.ErrTimeout, err)
+	actual, err := ioutil.ReadAll(NewParallelLineEditingReader(
+		iotest.TimeoutReader(strings.NewReader(input)), parallelEditForTest, ParallelLineEditingReaderOptions{}))
+	assert.Equal(t, iotest.ErrTimeout, err)
+	assert.Equal(t, string(expected), string(actual))
+	assert.Equal(t, "Xine 1\nXine 2\n", string(actual))
+}
+
+type countingReaderForTest struct {
+	r    io.Reader
+	read int64
+}
+
+func (r *countingReaderForTest) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(&r.read, int64(n))
+	return n, err
+}
+
+func TestParallelLineEditingReader_MaxInFlightAndClose(t *testing.T) {
+	input := &countingReaderForTest{r: strings.NewReader(strings.Repeat("0123456789\n", 100000))}
+	r := NewParallelLineEditingReader(input, parallelEditForTest,
+		ParallelLineEditingReaderOptions{Workers: 2, BatchSize: 1000, MaxInFlight: 3})
+	p := make([]byte, 1)
+	n, err := r.Read(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "X", string(p[:n]))
+	time.Sleep(50 * time.Millisecond)
+	// each batch reads up to its buffer capacity (BatchSize * 5/4), plus the partial line carried over.
+	assert.True(t, atomic.LoadInt64(&input.read) <= 3*1250+11, "read: %d", atomic.LoadInt64(&input.read))
+
+	assert.NoError(t, r.Close())
+	_, err = r.Read(p)
+	assert.Equal(t, ErrReaderClosed, err)
+
+	r = NewParallelLineEditingReader(strings.NewReader("abc"), parallelEditForTest, ParallelLineEditingReaderOptions{})
+	assert.NoError(t, r.Close())
+	_, err = r.Read(p)
+	assert.Equal(t, ErrReaderClosed, err)
+}
+
+var parallelLineEditingBenchInput = strings.Repeat(
+	"2024-01-15T10:20:30Z user=john.doe@example.com ip=10.1.2.3 action=login status=ok\n", 20000)
+
+var parallelLineEditingBenchRegex = regexp.MustCompile(`([\w.+-]+)@([\w-]+(?:\.[\w-]+)+)|(\d+)\.(\d+)\.(\d+)\.(\d+)`)
+
+func parallelLineEditingBenchEdit(line []byte) ([]byte, error) {
+	return parallelLineEditingBenchRegex.ReplaceAll(line, []byte("<redacted>")), nil
+}
+
+func BenchmarkParallelLineEditingReader_SerialRegexEdit(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ioutil.ReadAll(
+			NewLineEditingReader(strings.NewReader(parallelLineEditingBenchInput), parallelLineEditingBenchEdit))
+	}
+}
+
+func BenchmarkParallelLineEditingReader_ParallelRegexEdit(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ioutil.ReadAll(NewParallelLineEditingReader(
+			strings.NewReader(parallelLineEditingBenchInput), parallelLineEditingBenchEdit,
+			ParallelLineEditingReaderOptions{}))
+	}
+}
@@ -3,33 +3,133 @@ package ios
 import (
 	"bufio"
 	"encoding/csv"
-	"fmt"
+	"errors"
 	"io"
-	"reflect"
+	"sort"
 )
 
-// LineNumReportingCsvReader wraps std lib `*csv.Reader` and exposes the current line number.
+// LineNumReportingCsvReader wraps std lib `*csv.Reader` and exposes the current line number, the lines
+// of the last record read, and the byte offsets of its fields. It relies on `csv.Reader.FieldPos` and
+// `csv.Reader.InputOffset`, and keeps track of where each line starts in the input, so no reflection into
+// csv.Reader internals is needed. Note Read and ReadAll must be called on LineNumReportingCsvReader, not
+// on the embedded `*csv.Reader`, for the line numbers and offsets to be tracked.
 type LineNumReportingCsvReader struct {
 	*csv.Reader
-	numLineFieldName string
+	lines     *lineStartsReader
+	lineNum   int
+	startLine int
+	endLine   int
 }
 
-// LineNum returns the current line number
-func (r *LineNumReportingCsvReader) LineNum() int {
-	// Given the request to add line num report api on csv.Reader is denied
-	// per https://github.com/golang/go/issues/26679, let's use this hack to get
-	// the line number for our internal use.
-	value := reflect.ValueOf(*r).FieldByName(r.numLineFieldName)
-	if !value.IsValid() {
-		panic(fmt.Sprintf(
-			"unable to get '%s' from csv.Reader, has csv.Reader been changed/upgraded?", r.numLineFieldName))
+// Read reads one record from the input. See `csv.Reader.Read`.
+func (r *LineNumReportingCsvReader) Read() ([]string, error) {
+	// the next record starts after the last record's end line, so line starts before it are no longer
+	// needed.
+	r.lines.discardBefore(r.endLine)
+	record, err := r.Reader.Read()
+	var parseErr *csv.ParseError
+	switch {
+	case record != nil:
+		// a record can be returned with an error, e.g. csv.ErrFieldCount.
+		r.startLine, _ = r.Reader.FieldPos(0)
+		// InputOffset is right after the record, including its line ending, if any.
+		r.endLine = r.lines.lineAt(r.Reader.InputOffset() - 1)
+		r.lineNum = r.endLine
+	case err == io.EOF:
+		// same as csv.Reader, reaching EOF counts as reading in one more line.
+		r.lineNum = r.lines.lastLine() + 1
+		if r.lines.offset == 0 || r.lines.lastByte == '\n' {
+			r.lineNum--
+		}
+	case errors.As(err, &parseErr):
+		r.lineNum = parseErr.Line
 	}
-	return int(value.Int())
+	return record, err
+}
+
+// ReadAll reads all the remaining records from the input. See `csv.Reader.ReadAll`.
+func (r *LineNumReportingCsvReader) ReadAll() ([][]string, error) {
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// LineNum returns the current line number, i.e. the last line of the last record read. Before any record
+// is read, it is 0.
+func (r *LineNumReportingCsvReader) LineNum() int {
+	return r.lineNum
+}
+
+// RecordLines returns the first and last line numbers of the last record read. They differ only when the
+// record has multi-line quoted fields.
+func (r *LineNumReportingCsvReader) RecordLines() (start, end int) {
+	return r.startLine, r.endLine
+}
+
+// FieldOffset returns the byte offset in the input where the given field of the last record read starts;
+// for a quoted field, it is the offset of the opening quote. It panics if the field index is out of range.
+func (r *LineNumReportingCsvReader) FieldOffset(field int) int64 {
+	line, column := r.Reader.FieldPos(field)
+	return r.lines.lineStart(line) + int64(column-1)
 }
 
 // NewLineNumReportingCsvReader creates a new `*LineNumReportingCsvReader`.
 func NewLineNumReportingCsvReader(r io.Reader) *LineNumReportingCsvReader {
-	return &LineNumReportingCsvReader{csv.NewReader(r), "numLine"}
+	lines := &lineStartsReader{r: r, first: 1, starts: []int64{0}}
+	return &LineNumReportingCsvReader{Reader: csv.NewReader(lines), lines: lines}
+}
+
+// lineStartsReader wraps an io.Reader and records the offsets where the lines start, from line `first`
+// on. Given csv.Reader reads ahead, the lines recorded can be beyond the current record.
+type lineStartsReader struct {
+	r        io.Reader
+	offset   int64
+	lastByte byte
+	first    int
+	starts   []int64
+}
+
+func (r *lineStartsReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\n' {
+			r.starts = append(r.starts, r.offset+int64(i)+1)
+		}
+	}
+	if n > 0 {
+		r.offset += int64(n)
+		r.lastByte = p[n-1]
+	}
+	return n, err
+}
+
+func (r *lineStartsReader) lineStart(line int) int64 {
+	return r.starts[line-r.first]
+}
+
+// lineAt returns the line number of the byte at the given offset.
+func (r *lineStartsReader) lineAt(offset int64) int {
+	return r.first + sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > offset }) - 1
+}
+
+// lastLine returns the number of the last line started so far.
+func (r *lineStartsReader) lastLine() int {
+	return r.first + len(r.starts) - 1
+}
+
+func (r *lineStartsReader) discardBefore(line int) {
+	if n := line - r.first; n > 0 {
+		r.starts = r.starts[:copy(r.starts, r.starts[n:])]
+		r.first = line
+	}
 }
 
 // ByteReadLine reads in a single line from a bufio.Reader and returns it in []byte.
@@ -3,11 +3,14 @@ package ios
 import (
 	"bufio"
 	"bytes"
+	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -24,14 +27,107 @@ func TestLineNumReportingCsvReader(t *testing.T) {
 	assert.Nil(t, record)
 	assert.Equal(t, 2, r.LineNum())
 
-	r = NewLineNumReportingCsvReader(strings.NewReader("a,b,c"))
-	r.numLineFieldName = "non-existing"
-	assert.PanicsWithValue(
-		t,
-		"unable to get 'non-existing' from csv.Reader, has csv.Reader been changed/upgraded?",
-		func() {
-			r.LineNum()
-		})
+	r = NewLineNumReportingCsvReader(strings.NewReader("a,b,c\n"))
+	_, err = r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.LineNum())
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, r.LineNum())
+
+	r = NewLineNumReportingCsvReader(strings.NewReader(""))
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 1, r.LineNum())
+}
+
+func TestLineNumReportingCsvReader_RecordLinesAndFieldOffsets(t *testing.T) {
+	input := "# comment\n" +
+		"\n" +
+		"a,\"b\nmulti\r\nline\",c\r\n" +
+		"\"d\",, e \n" +
+		"f,\"\ng\"\n" +
+		"h,i,j"
+	type rec struct {
+		record    []string
+		lines     [2]int
+		lineNum   int
+		fieldsRaw []string
+	}
+	expected := []rec{
+		{[]string{"a", "b\nmulti\nline", "c"}, [2]int{3, 5}, 5, []string{"a", `"b`, "c"}},
+		{[]string{"d", "", " e "}, [2]int{6, 6}, 6, []string{`"d"`, ",", " e "}},
+		{[]string{"f", "\ng"}, [2]int{7, 8}, 8, []string{"f", "\"\ng\""}},
+		{[]string{"h", "i", "j"}, [2]int{9, 9}, 9, []string{"h", "i", "j"}},
+	}
+	for _, reader := range []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		iotest.OneByteReader,
+	} {
+		r := NewLineNumReportingCsvReader(reader(strings.NewReader(input)))
+		r.Comment = '#'
+		r.FieldsPerRecord = -1
+		for _, exp := range expected {
+			record, err := r.Read()
+			assert.NoError(t, err)
+			assert.Equal(t, exp.record, record)
+			start, end := r.RecordLines()
+			assert.Equal(t, exp.lines, [2]int{start, end})
+			assert.Equal(t, exp.lineNum, r.LineNum())
+			for i, raw := range exp.fieldsRaw {
+				assert.True(t, strings.HasPrefix(input[r.FieldOffset(i):], raw), "field %d of %q", i, record)
+			}
+		}
+		_, err := r.Read()
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, 10, r.LineNum())
+		assert.Panics(t, func() { r.FieldOffset(3) })
+	}
+}
+
+func TestLineNumReportingCsvReader_Errors(t *testing.T) {
+	r := NewLineNumReportingCsvReader(strings.NewReader("a,b\nc\n\"d\ne\"x\n"))
+	_, err := r.Read()
+	assert.NoError(t, err)
+	// csv.ErrFieldCount comes along with the record.
+	record, err := r.Read()
+	assert.True(t, errors.Is(err, csv.ErrFieldCount))
+	assert.Equal(t, []string{"c"}, record)
+	assert.Equal(t, 2, r.LineNum())
+	assert.Equal(t, int64(4), r.FieldOffset(0))
+	// a bare quote in a quoted field.
+	_, err = r.Read()
+	assert.True(t, errors.Is(err, csv.ErrQuote))
+	assert.Equal(t, 4, r.LineNum())
+
+	r = NewLineNumReportingCsvReader(strings.NewReader("a\n\"b\nc\nd"))
+	records, err := r.ReadAll()
+	assert.Error(t, err)
+	assert.Nil(t, records)
+	records, err = NewLineNumReportingCsvReader(strings.NewReader("a\nb\n")).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a"}, {"b"}}, records)
+}
+
+func TestLineNumReportingCsvReader_LongInput(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&sb, "%d,\"x\n%d\"\n", i, i)
+	}
+	input := sb.String()
+	r := NewLineNumReportingCsvReader(strings.NewReader(input))
+	for i := 0; i < 10000; i++ {
+		record, err := r.Read()
+		assert.NoError(t, err)
+		start, end := r.RecordLines()
+		if !assert.Equal(t, [2]int{2*i + 1, 2*i + 2}, [2]int{start, end}) {
+			return
+		}
+		assert.True(t, strings.HasPrefix(input[r.FieldOffset(0):], record[0]+","))
+		assert.True(t, strings.HasPrefix(input[r.FieldOffset(1):], `"x`))
+	}
+	// line starts of the records already read are discarded.
+	assert.True(t, len(r.lines.starts) < 1000)
 }
 
 func TestByteReadLineAndReadLine(t *testing.T) {
@@ -0,0 +1,149 @@
+package ios
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+)
+
+// ErrRegexMatchTooLong is returned by a BytesReplacingReader using a RegexReplacer when a match is, or
+// might be, longer than the max match length. Only the bytes before the match have been read by then.
+var ErrRegexMatchTooLong = errors.New("regex match might exceed max match length")
+
+// RegexReplacer is a BytesReplacer replacing the matches of a regexp, for BytesReplacingReader. As the
+// input is streamed, matches must be of a bounded length: the max match length. Because the input is
+// searched one buffer at a time, the regexp cannot have any assertion depending on what's around a
+// match (^, $, \A, \z, \b, \B). Empty matches are ignored. Unlike MultiBytesReplacer, a RegexReplacer
+// has a scratch buffer for expanding the replacement, so it cannot be shared by concurrent readers.
+type RegexReplacer struct {
+	re          *regexp.Regexp
+	replace     []byte
+	maxMatchLen int
+	// max bytes a match of one byte can be expanded to, i.e. max search/replace len ratio is 1/expand.
+	expand   int
+	expanded []byte
+	// pattern is the key all the matches are counted under in ReplacingStats.PerSearchToken.
+	pattern []byte
+}
+
+// NewRegexReplacer creates a RegexReplacer replacing the matches of re with replace, in which $1-style
+// references are expanded as by regexp.Regexp.Expand. maxMatchLen must be > 0.
+func NewRegexReplacer(re *regexp.Regexp, replace string, maxMatchLen int) *RegexReplacer {
+	if maxMatchLen <= 0 {
+		panic(fmt.Sprintf("max match length must be > 0, instead got: %d", maxMatchLen))
+	}
+	if hasContextAssertion(re) {
+		panic(`regex cannot have assertions: ^, $, \A, \z, \b or \B`)
+	}
+	// each reference expands to at most a match; the number of '$' is an upper bound of references.
+	refs := bytes.Count([]byte(replace), []byte("$"))
+	return &RegexReplacer{
+		re:          re,
+		replace:     []byte(replace),
+		maxMatchLen: maxMatchLen,
+		expand:      len(replace) + refs,
+		pattern:     []byte(re.String()),
+	}
+}
+
+func hasContextAssertion(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		// re may have been compiled by regexp.CompilePOSIX.
+		if parsed, err = syntax.Parse(re.String(), syntax.POSIX); err != nil {
+			panic(err)
+		}
+	}
+	var walk func(*syntax.Regexp) bool
+	walk = func(r *syntax.Regexp) bool {
+		switch r.Op {
+		case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+			syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+			return true
+		}
+		for _, sub := range r.Sub {
+			if walk(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(parsed)
+}
+
+func (r *RegexReplacer) searchStatsKey([]byte) []byte {
+	return r.pattern
+}
+
+// GetSizingHints implements BytesReplacer.
+func (r *RegexReplacer) GetSizingHints() (int, int, float64) {
+	// one extra byte of lookahead tells a match of max match length from a longer one.
+	maxSearchLen := r.maxMatchLen + 1
+	maxReplaceLen := len(r.replace) + (r.expand-len(r.replace))*r.maxMatchLen
+	ratio := float64(-1)
+	if r.expand > 1 {
+		ratio = 1 / float64(r.expand)
+	}
+	return maxSearchLen, maxReplaceLen, ratio
+}
+
+// Index implements BytesReplacer. Matches longer than the max match length are skipped.
+func (r *RegexReplacer) Index(buf []byte) (int, []byte, []byte) {
+	for from := 0; ; {
+		index, search, replace, err := r.IndexEx(buf[from:], true)
+		if index < 0 {
+			return -1, nil, nil
+		}
+		if err == nil {
+			return from + index, search, replace
+		}
+		// skip the whole match, or its tail would be matched next.
+		from += index + r.re.FindIndex(buf[from+index:])[1]
+	}
+}
+
+// IndexEx implements BytesReplacerEx. When a match is, or might be, longer than the max match length,
+// the index of the match is returned along with ErrRegexMatchTooLong.
+func (r *RegexReplacer) IndexEx(buf []byte, atEOF bool) (int, []byte, []byte, error) {
+	for from := 0; from <= len(buf); {
+		loc := r.re.FindIndex(buf[from:])
+		if loc == nil {
+			return -1, nil, nil, nil
+		}
+		start, end := from+loc[0], from+loc[1]
+		if !atEOF && start+r.maxMatchLen >= len(buf) {
+			// given more input, this might turn out a different match, or an earlier match that
+			// doesn't fully fit in buf might show up.
+			return -1, nil, nil, nil
+		}
+		if start == end {
+			from = start + 1
+			continue
+		}
+		if end-start > r.maxMatchLen {
+			return start, nil, nil, fmt.Errorf("%w: %d", ErrRegexMatchTooLong, r.maxMatchLen)
+		}
+		return start, buf[start:end], r.expandMatch(buf[start:end]), nil
+	}
+	return -1, nil, nil, nil
+}
+
+func (r *RegexReplacer) expandMatch(match []byte) []byte {
+	if r.expand == len(r.replace) {
+		// no '$', nothing to expand.
+		return r.replace
+	}
+	// submatches are only looked for (which is much slower) in the match. Without assertions, the
+	// match is the same as in the whole buf.
+	r.expanded = r.re.Expand(r.expanded[:0], r.replace, match, r.re.FindSubmatchIndex(match))
+	return r.expanded
+}
+
+// NewRegexReplacingReader creates a new `*BytesReplacingReader` replacing the matches of re with
+// replace, using a RegexReplacer. See RegexReplacer for the restrictions on re.
+func NewRegexReplacingReader(r io.Reader, re *regexp.Regexp, replace string, maxMatchLen int) *BytesReplacingReader {
+	return NewBytesReplacingReaderEx(r, NewRegexReplacer(re, replace, maxMatchLen))
+}
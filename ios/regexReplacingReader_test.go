@@ -0,0 +1,211 @@
+package ios
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexReplacingReader(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		input       string
+		re          *regexp.Regexp
+		replace     string
+		maxMatchLen int
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:        "no match",
+			input:       "hello world",
+			re:          regexp.MustCompile(`\d+`),
+			replace:     "#",
+			maxMatchLen: 10,
+			expected:    "hello world",
+		},
+		{
+			name:        "card numbers",
+			input:       "card 4111 1111 1111 1111 and 5500-0000-0000-0004, not 1234",
+			re:          regexp.MustCompile(`\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?(\d{4})`),
+			replace:     "****-****-****-$1",
+			maxMatchLen: 19,
+			expected:    "card ****-****-****-1111 and ****-****-****-0004, not 1234",
+		},
+		{
+			name:        "emails",
+			input:       "mail john.doe@example.com or jane@test.org.",
+			re:          regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`),
+			replace:     "<email>",
+			maxMatchLen: 64,
+			expected:    "mail <email> or <email>.",
+		},
+		{
+			name:        "named group expansion",
+			input:       "user=john password=s3cr3t! token=abc",
+			re:          regexp.MustCompile(`(?P<key>password|token)=\S+`),
+			replace:     "${key}=***",
+			maxMatchLen: 32,
+			expected:    "user=john password=*** token=***",
+		},
+		{
+			name:        "match at end of input",
+			input:       "abc 123",
+			re:          regexp.MustCompile(`\d+`),
+			replace:     "<$0>",
+			maxMatchLen: 3,
+			expected:    "abc <123>",
+		},
+		{
+			name:        "empty matches ignored",
+			input:       "a1b22c",
+			re:          regexp.MustCompile(`\d*`),
+			replace:     "#",
+			maxMatchLen: 5,
+			expected:    "a#b#c",
+		},
+		{
+			name:        "match longer than max match length",
+			input:       "abc 123 4567890 def",
+			re:          regexp.MustCompile(`\d+`),
+			replace:     "#",
+			maxMatchLen: 5,
+			expected:    "abc # ",
+			expectedErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, wrap := range []func(io.Reader) io.Reader{
+				func(r io.Reader) io.Reader { return r },
+				iotest.OneByteReader,
+				iotest.HalfReader,
+				iotest.DataErrReader,
+			} {
+				r := NewRegexReplacingReader(wrap(strings.NewReader(test.input)), test.re, test.replace, test.maxMatchLen)
+				result, err := ioutil.ReadAll(r)
+				if test.expectedErr {
+					assert.True(t, errors.Is(err, ErrRegexMatchTooLong))
+					assert.Equal(t, "regex match might exceed max match length: 5", err.Error())
+				} else {
+					assert.NoError(t, err)
+				}
+				assert.Equal(t, test.expected, string(result))
+			}
+		})
+	}
+
+	assert.PanicsWithValue(t, "max match length must be > 0, instead got: 0", func() {
+		NewRegexReplacingReader(strings.NewReader("test"), regexp.MustCompile("a"), "b", 0)
+	})
+	for _, expr := range []string{`^a`, `a$`, `\Aa`, `a\z`, `\ba`, `a\B`, `(?m)x|(^y)`} {
+		assert.PanicsWithValue(t, `regex cannot have assertions: ^, $, \A, \z, \b or \B`, func() {
+			NewRegexReplacingReader(strings.NewReader("test"), regexp.MustCompile(expr), "b", 10)
+		}, expr)
+	}
+	assert.NotPanics(t, func() {
+		NewRegexReplacingReader(strings.NewReader("test"), regexp.MustCompilePOSIX(`[[:digit:]]+`), "b", 10)
+	})
+}
+
+func TestRegexReplacer_GetSizingHints(t *testing.T) {
+	maxSearchLen, maxReplaceLen, ratio := NewRegexReplacer(regexp.MustCompile(`(\d)+`), "<$1>", 10).GetSizingHints()
+	assert.Equal(t, 11, maxSearchLen)
+	assert.Equal(t, 14, maxReplaceLen)
+	assert.Equal(t, float64(1)/5, ratio)
+
+	_, _, ratio = NewRegexReplacer(regexp.MustCompile(`\d+`), "#", 10).GetSizingHints()
+	assert.Equal(t, float64(-1), ratio)
+}
+
+func TestRegexReplacer_Index(t *testing.T) {
+	r := NewRegexReplacer(regexp.MustCompile(`\d+`), "#", 3)
+	index, search, replace := r.Index([]byte("ab 12345 cd 678"))
+	assert.Equal(t, 12, index)
+	assert.Equal(t, "678", string(search))
+	assert.Equal(t, "#", string(replace))
+	index, _, _ = r.Index([]byte("ab 12345"))
+	assert.Equal(t, -1, index)
+}
+
+func TestRegexReplacingReader_Stats(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, "card 4111-1111-1111-%04d\n", i)
+	}
+	r := NewRegexReplacingReader(strings.NewReader(input.String()), regexp.MustCompile(`\d{4}(-\d{4}){3}`),
+		"XXXX", 19).EnablePerSearchTokenStats(true)
+	_, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	// the matches, i.e. the card numbers, are all counted under the pattern.
+	assert.Equal(t, ReplacingStats{
+		Replacements:   1000,
+		PerSearchToken: map[string]int64{`\d{4}(-\d{4}){3}`: 1000},
+	}, r.Stats())
+}
+
+func TestRegexReplacingReader_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for _, test := range []struct {
+		re          *regexp.Regexp
+		replace     string
+		maxMatchLen int
+	}{
+		// the longest possible match of each regexp is maxMatchLen.
+		{re: regexp.MustCompile(`a[bc]{1,5}`), replace: "<$0>", maxMatchLen: 6},
+		{re: regexp.MustCompile(`(a)(b?)c`), replace: "$2$1", maxMatchLen: 3},
+		{re: regexp.MustCompile(`b+?`), replace: "xyzxyz", maxMatchLen: 1},
+		{re: regexp.MustCompilePOSIX(`(ab|abcd|d)`), replace: "_${1}_", maxMatchLen: 4},
+	} {
+		for i := 0; i < 50; i++ {
+			input := make([]byte, rnd.Intn(10000))
+			for j := range input {
+				input[j] = "abcd"[rnd.Intn(4)]
+			}
+			expected := test.re.ReplaceAll(input, []byte(test.replace))
+			r := NewRegexReplacingReader(&chunkReaderForTest{r: bytes.NewReader(input), rnd: rnd},
+				test.re, test.replace, test.maxMatchLen)
+			var result []byte
+			buf := make([]byte, 1+rnd.Intn(100))
+			for {
+				n, err := r.Read(buf)
+				result = append(result, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+			}
+			if !assert.Equal(t, string(expected), string(result), "regex: %s", test.re) {
+				return
+			}
+		}
+	}
+}
+
+func BenchmarkRegexReplacingReader_1MBLength_Emails(b *testing.B) {
+	searches := []string{"john.doe@example.com", "jane@test.org", "x+y@sub.domain.net"}
+	input := createMultiTokenTestInput(1024*1024, searches, 1000)
+	// break the input into words, or it would be a single too long match.
+	for i := 7; i < len(input); i += 8 {
+		input[i] = ' '
+	}
+	re := regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`)
+	r := &BytesReplacingReader{}
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ResetEx(bytes.NewReader(input), NewRegexReplacer(re, "<email>", 64))
+		_, err := ioutil.ReadAll(r)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package jsons
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a compiled JSONPath-like expression, which selects values out of a JSON document
+// decoded by encoding/json into interface{} (i.e. made of map[string]interface{}, []interface{} and
+// scalar values). The supported syntax is:
+//
+//	$                  the root; every expression starts with it.
+//	.name  ['name']    the member of an object; in brackets, names can be quoted by ' or ".
+//	.*  [*]            all the members of an object (in the order of their names) or elements of an array.
+//	[n]                the element of an array at index n; negative n counts from the end.
+//	[a,b]  ['a','b']   the union of multiple indexes or names.
+//	[start:end:step]   the elements of an array in a slice; all parts are optional, step must be > 0.
+//	..name  ..*  ..[n] recursive descent: the step applies to the value and all its descendants.
+//
+// Filters and script expressions are not supported. A compiled JSONPath is safe for concurrent use.
+type JSONPath struct {
+	expr  string
+	steps []jsonPathStep
+}
+
+type jsonPathStepKind int
+
+const (
+	jsonPathNames jsonPathStepKind = iota
+	jsonPathWildcard
+	jsonPathIndexes
+	jsonPathSlice
+)
+
+type jsonPathStep struct {
+	kind      jsonPathStepKind
+	recursive bool
+	names     []string
+	indexes   []int
+	// slice bounds; nil means omitted.
+	start, end *int
+	step       int
+}
+
+// CompileJSONPath compiles a JSONPath-like expression. See JSONPath for the supported syntax.
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	p := &JSONPath{expr: expr}
+	if !strings.HasPrefix(expr, "$") {
+		return nil, p.errorf(0, "must start with '$'")
+	}
+	for pos := 1; pos < len(expr); {
+		recursive := false
+		switch {
+		case strings.HasPrefix(expr[pos:], ".."):
+			recursive = true
+			pos += 2
+		case expr[pos] == '.':
+			pos++
+		case expr[pos] == '[':
+		default:
+			return nil, p.errorf(pos, "unexpected character %q", expr[pos])
+		}
+		var step jsonPathStep
+		var err error
+		if pos < len(expr) && expr[pos] == '[' {
+			step, pos, err = p.parseBracket(pos)
+		} else {
+			step, pos, err = p.parseDotted(pos)
+		}
+		if err != nil {
+			return nil, err
+		}
+		step.recursive = recursive
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+func (p *JSONPath) errorf(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSONPath '%s' at position %d: %s", p.expr, pos, fmt.Sprintf(format, args...))
+}
+
+// parseDotted parses the name (or '*') after a '.' or '..'.
+func (p *JSONPath) parseDotted(pos int) (jsonPathStep, int, error) {
+	end := pos
+	for end < len(p.expr) && p.expr[end] != '.' && p.expr[end] != '[' {
+		end++
+	}
+	switch name := p.expr[pos:end]; name {
+	case "":
+		return jsonPathStep{}, pos, p.errorf(pos, "missing name")
+	case "*":
+		return jsonPathStep{kind: jsonPathWildcard}, end, nil
+	default:
+		return jsonPathStep{kind: jsonPathNames, names: []string{name}}, end, nil
+	}
+}
+
+// parseBracket parses a bracketed step starting at the '['.
+func (p *JSONPath) parseBracket(pos int) (jsonPathStep, int, error) {
+	end := pos + 1
+	var quote byte
+	for ; end < len(p.expr); end++ {
+		c := p.expr[end]
+		switch {
+		case quote != 0 && c == '\\':
+			end++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == 0 && c == ']':
+			step, err := p.parseBracketContent(pos+1, p.expr[pos+1:end])
+			return step, end + 1, err
+		}
+	}
+	return jsonPathStep{}, pos, p.errorf(pos, "missing ']'")
+}
+
+func (p *JSONPath) parseBracketContent(pos int, content string) (jsonPathStep, error) {
+	content = strings.TrimSpace(content)
+	switch {
+	case content == "":
+		return jsonPathStep{}, p.errorf(pos, "empty brackets")
+	case content == "*":
+		return jsonPathStep{kind: jsonPathWildcard}, nil
+	case content[0] == '\'' || content[0] == '"':
+		names, err := p.parseQuotedNames(pos, content)
+		return jsonPathStep{kind: jsonPathNames, names: names}, err
+	case strings.Contains(content, ":"):
+		return p.parseSlice(pos, content)
+	}
+	step := jsonPathStep{kind: jsonPathIndexes}
+	for _, s := range strings.Split(content, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return jsonPathStep{}, p.errorf(pos, "invalid index '%s'", s)
+		}
+		step.indexes = append(step.indexes, n)
+	}
+	return step, nil
+}
+
+func (p *JSONPath) parseQuotedNames(pos int, content string) ([]string, error) {
+	var names []string
+	for i := 0; ; {
+		if i >= len(content) || (content[i] != '\'' && content[i] != '"') {
+			return nil, p.errorf(pos+i, "quoted name expected")
+		}
+		quote := content[i]
+		var name strings.Builder
+		i++
+		for ; i < len(content) && content[i] != quote; i++ {
+			if content[i] == '\\' && i+1 < len(content) {
+				i++
+			}
+			name.WriteByte(content[i])
+		}
+		if i >= len(content) {
+			return nil, p.errorf(pos+i, "unterminated quoted name")
+		}
+		names = append(names, name.String())
+		i++
+		for i < len(content) && content[i] == ' ' {
+			i++
+		}
+		if i == len(content) {
+			return names, nil
+		}
+		if content[i] != ',' {
+			return nil, p.errorf(pos+i, "',' expected")
+		}
+		i++
+		for i < len(content) && content[i] == ' ' {
+			i++
+		}
+	}
+}
+
+func (p *JSONPath) parseSlice(pos int, content string) (jsonPathStep, error) {
+	parts := strings.Split(content, ":")
+	if len(parts) > 3 {
+		return jsonPathStep{}, p.errorf(pos, "invalid slice '%s'", content)
+	}
+	step := jsonPathStep{kind: jsonPathSlice, step: 1}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return jsonPathStep{}, p.errorf(pos, "invalid slice '%s'", content)
+		}
+		switch i {
+		case 0:
+			step.start = &n
+		case 1:
+			step.end = &n
+		default:
+			if n <= 0 {
+				return jsonPathStep{}, p.errorf(pos, "slice step must be > 0, instead got: %d", n)
+			}
+			step.step = n
+		}
+	}
+	return step, nil
+}
+
+// String returns the expression the JSONPath is compiled from.
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Eval returns all the values in doc selected by the JSONPath, in document order. It returns nil if
+// nothing is selected.
+func (p *JSONPath) Eval(doc interface{}) []interface{} {
+	nodes := []interface{}{doc}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, node := range nodes {
+			if step.recursive {
+				walkJSON(node, func(v interface{}) { next = step.apply(v, next) })
+			} else {
+				next = step.apply(node, next)
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// walkJSON calls fn with v and all its descendants, in pre-order.
+func walkJSON(v interface{}, fn func(interface{})) {
+	fn(v)
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(t) {
+			walkJSON(t[k], fn)
+		}
+	case []interface{}:
+		for _, e := range t {
+			walkJSON(e, fn)
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *jsonPathStep) apply(v interface{}, out []interface{}) []interface{} {
+	switch s.kind {
+	case jsonPathNames:
+		if m, ok := v.(map[string]interface{}); ok {
+			for _, name := range s.names {
+				if child, found := m[name]; found {
+					out = append(out, child)
+				}
+			}
+		}
+	case jsonPathWildcard:
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for _, k := range sortedKeys(t) {
+				out = append(out, t[k])
+			}
+		case []interface{}:
+			out = append(out, t...)
+		}
+	case jsonPathIndexes:
+		if a, ok := v.([]interface{}); ok {
+			for _, i := range s.indexes {
+				if i < 0 {
+					i += len(a)
+				}
+				if i >= 0 && i < len(a) {
+					out = append(out, a[i])
+				}
+			}
+		}
+	case jsonPathSlice:
+		if a, ok := v.([]interface{}); ok {
+			start, end := sliceBound(s.start, 0, len(a)), sliceBound(s.end, len(a), len(a))
+			for i := start; i < end; i += s.step {
+				out = append(out, a[i])
+				if s.step >= end-i {
+					// the next index is past end; stop before i += s.step overflows with a huge step.
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// sliceBound resolves a slice bound the python way: negative counts from the end, and out of range
+// values are clamped.
+func sliceBound(bound *int, dflt, n int) int {
+	if bound == nil {
+		return dflt
+	}
+	b := *bound
+	if b < 0 {
+		b += n
+	}
+	if b < 0 {
+		return 0
+	}
+	if b > n {
+		return n
+	}
+	return b
+}
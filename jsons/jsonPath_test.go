@@ -0,0 +1,102 @@
+package jsons
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonPathTestDoc = `{
+	"store": {
+		"book": [
+			{ "title": "a", "price": 8.95, "tags": ["x"] },
+			{ "title": "b", "price": 12.99 },
+			{ "title": "c", "price": 8.99, "isbn": "0-553-21311-3" },
+			{ "title": "d", "price": 22.99, "isbn": "0-395-19395-8" }
+		],
+		"bicycle": { "color": "red", "price": 19.95 },
+		"weird key": "w"
+	}
+}`
+
+func TestJSONPath_Eval(t *testing.T) {
+	var doc interface{}
+	assert.NoError(t, json.Unmarshal([]byte(jsonPathTestDoc), &doc))
+	for _, test := range []struct {
+		name     string
+		expr     string
+		expected []interface{}
+	}{
+		{name: "root", expr: "$", expected: []interface{}{doc}},
+		{name: "dotted", expr: "$.store.bicycle.color", expected: []interface{}{"red"}},
+		{name: "bracketed names", expr: `$['store']["weird key"]`, expected: []interface{}{"w"}},
+		{name: "escaped quote", expr: `$['it\'s']`, expected: nil},
+		{name: "index", expr: "$.store.book[1].title", expected: []interface{}{"b"}},
+		{name: "negative index", expr: "$.store.book[-1].title", expected: []interface{}{"d"}},
+		{name: "out of range index", expr: "$.store.book[10].title", expected: nil},
+		{name: "index union", expr: "$.store.book[0, 2].title", expected: []interface{}{"a", "c"}},
+		{name: "name union", expr: "$.store.bicycle['price','color']", expected: []interface{}{19.95, "red"}},
+		{name: "wildcard array", expr: "$.store.book[*].title", expected: []interface{}{"a", "b", "c", "d"}},
+		{name: "wildcard object in name order", expr: "$.store.bicycle.*", expected: []interface{}{"red", 19.95}},
+		{name: "slice", expr: "$.store.book[1:3].title", expected: []interface{}{"b", "c"}},
+		{name: "slice open start", expr: "$.store.book[:2].title", expected: []interface{}{"a", "b"}},
+		{name: "slice negative start", expr: "$.store.book[-2:].title", expected: []interface{}{"c", "d"}},
+		{name: "slice with step", expr: "$.store.book[::2].title", expected: []interface{}{"a", "c"}},
+		{name: "slice clamped", expr: "$.store.book[-10:10:3].title", expected: []interface{}{"a", "d"}},
+		{
+			name:     "slice with max int step",
+			expr:     fmt.Sprintf("$.store.book[1::%d].title", math.MaxInt64),
+			expected: []interface{}{"b"},
+		},
+		{name: "recursive descent", expr: "$..isbn", expected: []interface{}{"0-553-21311-3", "0-395-19395-8"}},
+		{
+			name:     "recursive descent in document order",
+			expr:     "$.store..price",
+			expected: []interface{}{19.95, 8.95, 12.99, 8.99, 22.99},
+		},
+		{name: "recursive descent with index", expr: "$..tags[0]", expected: []interface{}{"x"}},
+		{name: "recursive descent with brackets", expr: "$..book[2].title", expected: []interface{}{"c"}},
+		{name: "name on array", expr: "$.store.book.title", expected: nil},
+		{name: "index on object", expr: "$.store[0]", expected: nil},
+		{name: "missing", expr: "$.nothing.here", expected: nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := CompileJSONPath(test.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expr, p.String())
+			assert.Equal(t, test.expected, p.Eval(doc))
+		})
+	}
+}
+
+func TestCompileJSONPath_Failure(t *testing.T) {
+	for _, test := range []struct {
+		expr        string
+		expectedErr string
+	}{
+		{expr: "", expectedErr: "invalid JSONPath '' at position 0: must start with '$'"},
+		{expr: "a.b", expectedErr: "invalid JSONPath 'a.b' at position 0: must start with '$'"},
+		{expr: "$a", expectedErr: `invalid JSONPath '$a' at position 1: unexpected character 'a'`},
+		{expr: "$.", expectedErr: "invalid JSONPath '$.' at position 2: missing name"},
+		{expr: "$.a..", expectedErr: "invalid JSONPath '$.a..' at position 5: missing name"},
+		{expr: "$[0", expectedErr: "invalid JSONPath '$[0' at position 1: missing ']'"},
+		{expr: "$['a]", expectedErr: "invalid JSONPath '$['a]' at position 1: missing ']'"},
+		{expr: "$[]", expectedErr: "invalid JSONPath '$[]' at position 2: empty brackets"},
+		{expr: "$[a]", expectedErr: "invalid JSONPath '$[a]' at position 2: invalid index 'a'"},
+		{expr: "$['a' 'b']", expectedErr: "invalid JSONPath '$['a' 'b']' at position 6: ',' expected"},
+		{expr: "$['a', 1]", expectedErr: "invalid JSONPath '$['a', 1]' at position 7: quoted name expected"},
+		{expr: "$[1:2:3:4]", expectedErr: "invalid JSONPath '$[1:2:3:4]' at position 2: invalid slice '1:2:3:4'"},
+		{expr: "$[a:]", expectedErr: "invalid JSONPath '$[a:]' at position 2: invalid slice 'a:'"},
+		{expr: "$[::0]", expectedErr: "invalid JSONPath '$[::0]' at position 2: slice step must be > 0, instead got: 0"},
+		{expr: "$[?(@.a)]", expectedErr: "invalid JSONPath '$[?(@.a)]' at position 2: invalid index '?(@.a)'"},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			p, err := CompileJSONPath(test.expr)
+			assert.EqualError(t, err, test.expectedErr)
+			assert.Nil(t, p)
+		})
+	}
+}